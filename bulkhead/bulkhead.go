@@ -0,0 +1,119 @@
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+)
+
+var (
+	// ErrBulkheadFull is returned when all the slots are taken and the wait
+	// queue is full, it matches ratelimiter.ErrLimitExceed with errors.Is.
+	ErrBulkheadFull = fmt.Errorf("bulkhead: full: %w", ratelimiter.ErrLimitExceed)
+	// ErrWaitTimeout is returned when no slot is released before the wait
+	// deadline, it matches ratelimiter.ErrLimitExceed with errors.Is.
+	ErrWaitTimeout = fmt.Errorf("bulkhead: wait timeout: %w", ratelimiter.ErrLimitExceed)
+)
+
+var _ ratelimiter.RateLimiter = (*Bulkhead)(nil)
+
+// Bulkhead isolates a dependency by capping the number of concurrent calls.
+type Bulkhead struct {
+	sem     chan struct{}
+	waiting int64
+
+	opts options
+}
+
+// Stat contains the metrics snapshot of bulkhead.
+type Stat struct {
+	InFlight int64
+	Waiting  int64
+}
+
+// New returns a bulkhead with options.
+func New(opts ...Option) *Bulkhead {
+	opt := options{
+		MaxConcurrent: 100,
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	if opt.MaxConcurrent < 1 {
+		opt.MaxConcurrent = 1
+	}
+	// a wait needs a queue to wait in.
+	if opt.MaxWait > 0 && opt.MaxQueue <= 0 {
+		opt.MaxQueue = opt.MaxConcurrent
+	}
+	return &Bulkhead{
+		sem:  make(chan struct{}, opt.MaxConcurrent),
+		opts: opt,
+	}
+}
+
+// Allow takes a slot, waiting at most the max wait duration for it.
+func (b *Bulkhead) Allow() (ratelimiter.DoneFunc, error) {
+	if b.opts.MaxWait <= 0 {
+		return b.tryAcquire()
+	}
+	return b.AllowCtx(context.Background())
+}
+
+// AllowCtx takes a slot, waiting for it in the queue until the context is
+// done or the max wait duration elapses. The returned DoneFunc releases
+// the slot and must be called exactly once.
+func (b *Bulkhead) AllowCtx(ctx context.Context) (ratelimiter.DoneFunc, error) {
+	if done, err := b.tryAcquire(); err == nil {
+		return done, nil
+	}
+	if atomic.AddInt64(&b.waiting, 1) > int64(b.opts.MaxQueue) {
+		atomic.AddInt64(&b.waiting, -1)
+		return nil, ErrBulkheadFull
+	}
+	defer atomic.AddInt64(&b.waiting, -1)
+
+	if b.opts.MaxWait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.opts.MaxWait)
+		defer cancel()
+	}
+	select {
+	case b.sem <- struct{}{}:
+		return b.release(), nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, ErrWaitTimeout
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (b *Bulkhead) tryAcquire() (ratelimiter.DoneFunc, error) {
+	select {
+	case b.sem <- struct{}{}:
+		return b.release(), nil
+	default:
+		return nil, ErrBulkheadFull
+	}
+}
+
+func (b *Bulkhead) release() ratelimiter.DoneFunc {
+	var released int32
+	return func(ratelimiter.DoneInfo) {
+		if atomic.CompareAndSwapInt32(&released, 0, 1) {
+			<-b.sem
+		}
+	}
+}
+
+// Stat takes a snapshot of the bulkhead.
+func (b *Bulkhead) Stat() Stat {
+	return Stat{
+		InFlight: int64(len(b.sem)),
+		Waiting:  atomic.LoadInt64(&b.waiting),
+	}
+}
@@ -0,0 +1,118 @@
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllow(t *testing.T) {
+	b := New(WithMaxConcurrent(2))
+	done1, err := b.Allow()
+	assert.Nil(t, err)
+	done2, err := b.Allow()
+	assert.Nil(t, err)
+	_, err = b.Allow()
+	assert.Equal(t, ErrBulkheadFull, err)
+	assert.True(t, errors.Is(err, ratelimiter.ErrLimitExceed))
+	assert.Equal(t, Stat{InFlight: 2}, b.Stat())
+
+	done1(ratelimiter.DoneInfo{})
+	// releasing twice must not free another slot.
+	done1(ratelimiter.DoneInfo{})
+	assert.Equal(t, Stat{InFlight: 1}, b.Stat())
+	done3, err := b.Allow()
+	assert.Nil(t, err)
+	done2(ratelimiter.DoneInfo{})
+	done3(ratelimiter.DoneInfo{})
+	assert.Equal(t, Stat{}, b.Stat())
+}
+
+func TestAllowCtx(t *testing.T) {
+	t.Run("wait for a slot", func(t *testing.T) {
+		b := New(WithMaxConcurrent(1), WithMaxQueue(1))
+		done, _ := b.Allow()
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			done(ratelimiter.DoneInfo{})
+		}()
+		done, err := b.AllowCtx(context.Background())
+		assert.Nil(t, err)
+		done(ratelimiter.DoneInfo{})
+	})
+	t.Run("queue full", func(t *testing.T) {
+		b := New(WithMaxConcurrent(1), WithMaxQueue(1))
+		done, _ := b.Allow()
+		defer done(ratelimiter.DoneInfo{})
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := b.AllowCtx(ctx)
+			assert.Equal(t, context.Canceled, err)
+		}()
+		for b.Stat().Waiting == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		_, err := b.AllowCtx(context.Background())
+		assert.Equal(t, ErrBulkheadFull, err)
+		cancel()
+		wg.Wait()
+		assert.Equal(t, Stat{InFlight: 1}, b.Stat())
+	})
+	t.Run("wait timeout", func(t *testing.T) {
+		b := New(WithMaxConcurrent(1), WithMaxQueue(1), WithMaxWait(10*time.Millisecond))
+		done, _ := b.Allow()
+		defer done(ratelimiter.DoneInfo{})
+		_, err := b.Allow()
+		assert.Equal(t, ErrWaitTimeout, err)
+		assert.True(t, errors.Is(err, ratelimiter.ErrLimitExceed))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		_, err = b.AllowCtx(ctx)
+		assert.Equal(t, ErrWaitTimeout, err)
+	})
+	t.Run("wait without queue", func(t *testing.T) {
+		b := New(WithMaxConcurrent(1), WithMaxWait(10*time.Millisecond))
+		done, _ := b.Allow()
+		defer done(ratelimiter.DoneInfo{})
+		_, err := b.Allow()
+		assert.Equal(t, ErrWaitTimeout, err)
+	})
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	b := New(WithMaxConcurrent(5), WithMaxQueue(100))
+	var wg sync.WaitGroup
+	var inFlight, max int64
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done, err := b.AllowCtx(context.Background())
+			if !assert.Nil(t, err) {
+				return
+			}
+			n := atomic.AddInt64(&inFlight, 1)
+			for {
+				m := atomic.LoadInt64(&max)
+				if n <= m || atomic.CompareAndSwapInt64(&max, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt64(&inFlight, -1)
+			done(ratelimiter.DoneInfo{})
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, max, int64(5))
+}
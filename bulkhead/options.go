@@ -0,0 +1,41 @@
+package bulkhead
+
+import "time"
+
+// Option function for bulkhead
+type Option func(*options)
+
+// options of bulkhead.
+type options struct {
+	// MaxConcurrent defines the maximum number of concurrent calls
+	MaxConcurrent int
+	// MaxQueue defines the maximum number of calls waiting for a slot
+	MaxQueue int
+	// MaxWait defines the maximum duration a call waits for a slot
+	MaxWait time.Duration
+}
+
+// WithMaxConcurrent with the maximum number of concurrent calls.
+func WithMaxConcurrent(n int) Option {
+	return func(o *options) {
+		o.MaxConcurrent = n
+	}
+}
+
+// WithMaxQueue with the maximum number of calls waiting for a slot, zero
+// rejects the calls once all the slots are taken unless a max wait is set,
+// the queue then defaults to the max concurrent calls.
+func WithMaxQueue(n int) Option {
+	return func(o *options) {
+		o.MaxQueue = n
+	}
+}
+
+// WithMaxWait with the maximum duration a call waits for a slot, zero lets
+// Allow reject immediately and AllowCtx wait until the context is done.
+// The calls only wait while the queue, see WithMaxQueue, has room.
+func WithMaxWait(d time.Duration) Option {
+	return func(o *options) {
+		o.MaxWait = d
+	}
+}
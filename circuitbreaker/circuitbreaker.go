@@ -1,6 +1,9 @@
 package circuitbreaker
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 // ErrNotAllowed error not allowed.
 var ErrNotAllowed = errors.New("circuitbreaker: not allowed for circuit open")
@@ -11,3 +14,16 @@ type CircuitBreaker interface {
 	MarkSuccess()
 	MarkFailed()
 }
+
+// LatencyMarker is implemented by circuit breakers which take the latency
+// of the successful requests into account.
+type LatencyMarker interface {
+	MarkSuccessWithLatency(d time.Duration)
+}
+
+// Releaser is implemented by circuit breakers which keep track of the
+// allowed requests, Release gives back an allowed request which is never
+// marked, e.g. its outcome is ignored.
+type Releaser interface {
+	Release()
+}
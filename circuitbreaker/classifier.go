@@ -0,0 +1,98 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+)
+
+// Outcome is the way the result of a call is recorded by a breaker.
+type Outcome int
+
+const (
+	// OutcomeSuccess marks the breaker with MarkSuccess.
+	OutcomeSuccess Outcome = iota
+	// OutcomeFailure marks the breaker with MarkFailed.
+	OutcomeFailure
+	// OutcomeIgnore does not mark the breaker, a Releaser is released.
+	OutcomeIgnore
+)
+
+// Classifier decides the Outcome of the error returned by a call.
+type Classifier func(err error) Outcome
+
+// ClassifierOption is Classifier option function.
+type ClassifierOption func(*classifierOptions)
+
+type classifierOptions struct {
+	ignored   []error
+	successes []error
+	failure   func(err error) bool
+}
+
+// WithIgnoredErrors with the errors not recorded by the breaker,
+// context.Canceled is always ignored.
+func WithIgnoredErrors(errs ...error) ClassifierOption {
+	return func(o *classifierOptions) {
+		o.ignored = append(o.ignored, errs...)
+	}
+}
+
+// WithSuccessErrors with the errors recorded as success, e.g. the client-side
+// errors which say nothing about the health of the downstream.
+func WithSuccessErrors(errs ...error) ClassifierOption {
+	return func(o *classifierOptions) {
+		o.successes = append(o.successes, errs...)
+	}
+}
+
+// WithFailurePredicate with the predicate reporting whether an error not
+// matched by the other rules is a failure, by default every error is.
+func WithFailurePredicate(f func(err error) bool) ClassifierOption {
+	return func(o *classifierOptions) {
+		o.failure = f
+	}
+}
+
+// NewClassifier returns a Classifier with options. The rules are applied in
+// order: nil is a success, ignored errors are ignored, success errors are
+// successes, timeouts are failures, then the failure predicate decides.
+func NewClassifier(opts ...ClassifierOption) Classifier {
+	o := classifierOptions{
+		ignored: []error{context.Canceled},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return func(err error) Outcome {
+		switch {
+		case err == nil:
+			return OutcomeSuccess
+		case isAny(err, o.ignored):
+			return OutcomeIgnore
+		case isAny(err, o.successes):
+			return OutcomeSuccess
+		case isTimeout(err):
+			return OutcomeFailure
+		case o.failure != nil && !o.failure(err):
+			return OutcomeSuccess
+		}
+		return OutcomeFailure
+	}
+}
+
+func isAny(err error, targets []error) bool {
+	for _, target := range targets {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var t interface{ Timeout() bool }
+	return errors.As(err, &t) && t.Timeout()
+}
@@ -3,11 +3,13 @@ package cooh
 import (
 	"math"
 	"math/rand"
+	"runtime"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/devexps/go-pkg/v2/circuitbreaker"
+	"github.com/devexps/go-pkg/v2/clock"
 	"github.com/devexps/go-pkg/v2/window"
 )
 
@@ -23,23 +25,112 @@ const (
 	StateClosed
 )
 
+var (
+	// randSeed seeds the generators of randPool.
+	randSeed = time.Now().UnixNano()
+	// randPool holds per-P random generators, so the drop decisions
+	// of the breakers are not serialized on a single lock.
+	randPool = sync.Pool{
+		New: func() interface{} {
+			return rand.New(rand.NewSource(atomic.AddInt64(&randSeed, 1)))
+		},
+	}
+)
+
 var (
 	_ circuitbreaker.CircuitBreaker = (*Breaker)(nil)
+	_ circuitbreaker.Stater         = (*Breaker)(nil)
+	_ circuitbreaker.LatencyMarker  = (*Breaker)(nil)
 )
 
 // Breaker is a COOH CircuitBreaker pattern.
 type Breaker struct {
-	stat window.RollingCounter
-	r    *rand.Rand
+	// conf holds the *config of the breaker, replaced as a whole by Reconfigure.
+	conf atomic.Value
+	// confLock serializes the calls of Reconfigure.
+	confLock sync.Mutex
+
+	// r is only set with a user supplied source, randPool is used otherwise.
+	r *rand.Rand
 	// rand.New(...) returns a non thread safe object
 	randLock sync.Mutex
 
+	state int32
+
+	name          string
+	onStateChange func(name string, from, to int32)
+	// draining is set while a single goroutine reports the transitions to
+	// the callback, reported is the last state it reported and is only
+	// accessed by that goroutine.
+	draining int32
+	reported int32
+}
+
+// config is the part of the breaker which can be changed at runtime.
+type config struct {
+	opts options
+	stat counter
+
 	// Reducing the k will make adaptive throttling behave more aggressively,
 	// Increasing the k will make adaptive throttling behave less aggressively.
 	k       float64
 	request int64
 
-	state int32
+	// slowStat counts 1 for every slow request and 0 for every fast one,
+	// it is only used when the slow call ratio is set.
+	slowStat counter
+
+	// marking is the number of marks being added to the counters.
+	marking int64
+}
+
+type counter interface {
+	window.RollingCounter
+	window.Snapshotter
+}
+
+// newConfig returns a config reusing the counters of prev when the window
+// does not change, the other counters are empty until carryOver.
+func newConfig(opt options, prev *config) *config {
+	var prevStat, prevSlowStat counter
+	if prev != nil && prev.opts.bucket == opt.bucket && prev.opts.window == opt.window {
+		prevStat, prevSlowStat = prev.stat, prev.slowStat
+	}
+	c := &config{
+		opts:    opt,
+		stat:    newCounter(opt, prevStat),
+		k:       1 / opt.success,
+		request: opt.request,
+	}
+	if prev == nil && opt.initial != nil {
+		c.stat.Restore(*opt.initial)
+	}
+	if opt.slowCall > 0 && opt.slowRatio > 0 {
+		c.slowStat = newCounter(opt, prevSlowStat)
+	}
+	return c
+}
+
+// newCounter returns prev if set, otherwise a new counter.
+func newCounter(opt options, prev counter) counter {
+	if prev != nil {
+		return prev
+	}
+	return window.NewRollingCounter(window.RollingCounterOpts{
+		Size:           opt.bucket,
+		BucketDuration: time.Duration(int64(opt.window) / int64(opt.bucket)),
+		Clock:          opt.clock,
+	}).(counter)
+}
+
+// carryOver adds the buckets of the counters of prev which are not reused.
+func (c *config) carryOver(prev *config) {
+	if c.stat != prev.stat {
+		c.stat.Restore(prev.stat.Snapshot())
+	}
+	if c.slowStat != nil && prev.slowStat != nil && c.slowStat != prev.slowStat {
+		c.slowStat.Restore(prev.slowStat.Snapshot())
+	}
 }
 
 // NewBreaker return a COOH Breaker with options
@@ -49,26 +140,85 @@ func NewBreaker(opts ...Option) circuitbreaker.CircuitBreaker {
 		request: 100,
 		bucket:  10,
 		window:  3 * time.Second,
+		clock:   clock.New(),
 	}
 	for _, o := range opts {
 		o(&opt)
 	}
-	counterOpts := window.RollingCounterOpts{
-		Size:           opt.bucket,
-		BucketDuration: time.Duration(int64(opt.window) / int64(opt.bucket)),
+	var r *rand.Rand
+	if opt.src != nil {
+		r = rand.New(opt.src)
 	}
-	stat := window.NewRollingCounter(counterOpts)
-	return &Breaker{
-		stat:    stat,
-		r:       rand.New(rand.NewSource(time.Now().UnixNano())),
-		request: opt.request,
-		k:       1 / opt.success,
-		state:   StateClosed,
+	b := &Breaker{
+		r:     r,
+		state: StateClosed,
+
+		name:          opt.name,
+		onStateChange: opt.onStateChange,
+		reported:      StateClosed,
+	}
+	b.conf.Store(newConfig(opt, nil))
+	return b
+}
+
+func (b *Breaker) config() *config {
+	return b.conf.Load().(*config)
+}
+
+// Reconfigure applies the options on top of the current ones at runtime.
+// The success and request options take effect atomically, a change of the
+// bucket or window options rebuilds the statistical window carrying over the
+// recent counts. The name, callback, clock and random source options are
+// ignored.
+func (b *Breaker) Reconfigure(opts ...Option) {
+	b.confLock.Lock()
+	defer b.confLock.Unlock()
+	prev := b.config()
+	opt := prev.opts
+	for _, o := range opts {
+		o(&opt)
+	}
+	opt.clock = prev.opts.clock
+	c := newConfig(opt, prev)
+	b.conf.Store(c)
+	// wait for the marks still adding to the previous counters, the
+	// next ones go to the new config.
+	for atomic.LoadInt64(&prev.marking) != 0 {
+		runtime.Gosched()
+	}
+	c.carryOver(prev)
+}
+
+// acquire returns the current config for adding a mark, the caller must
+// call release once done.
+func (b *Breaker) acquire() *config {
+	for {
+		c := b.config()
+		atomic.AddInt64(&c.marking, 1)
+		if b.config() == c {
+			return c
+		}
+		// replaced by Reconfigure in the meantime.
+		atomic.AddInt64(&c.marking, -1)
 	}
 }
 
+func (c *config) release() {
+	atomic.AddInt64(&c.marking, -1)
+}
+
+// Snapshot returns a copy of the statistical window of the breaker, it can
+// be encoded to JSON, persisted, and restored with WithInitialState.
+func (b *Breaker) Snapshot() window.Snapshot {
+	return b.config().stat.Snapshot()
+}
+
 func (b *Breaker) summary() (success int64, total int64) {
-	b.stat.Reduce(func(iterator window.Iterator) float64 {
+	return summary(b.config().stat)
+}
+
+func summary(stat window.RollingCounter) (success int64, total int64) {
+	stat.Reduce(func(iterator window.Iterator) float64 {
 		for iterator.Next() {
 			bucket := iterator.Bucket()
 			total += bucket.Count
@@ -83,16 +233,17 @@ func (b *Breaker) summary() (success int64, total int64) {
 
 // Allow request if error returns nil.
 func (b *Breaker) Allow() error {
+	c := b.config()
 	// The number of requests accepted by the backend
-	accepts, total := b.summary()
+	accepts, total := summary(c.stat)
 	// The number of requests attempted by the application layer(at the client, on top of the adaptive throttling system)
-	requests := b.k * float64(accepts)
+	requests := c.k * float64(accepts)
 	// check overflow requests = K * accepts
-	if total < b.request || float64(total) < requests {
-		atomic.CompareAndSwapInt32(&b.state, StateOpen, StateClosed)
+	if total < c.request || float64(total) < requests {
+		b.transit(StateOpen, StateClosed)
 		return nil
 	}
-	atomic.CompareAndSwapInt32(&b.state, StateClosed, StateOpen)
+	b.transit(StateClosed, StateOpen)
 	dr := math.Max(0, (float64(total)-requests)/float64(total+1))
 	drop := b.trueOnProba(dr)
 	if drop {
@@ -101,18 +252,115 @@ func (b *Breaker) Allow() error {
 	return nil
 }
 
+// State returns the current state of the breaker.
+func (b *Breaker) State() int32 {
+	return atomic.LoadInt32(&b.state)
+}
+
+// Stat returns the state and the success/total counts within the window.
+func (b *Breaker) Stat() circuitbreaker.Stat {
+	success, total := b.summary()
+	state := "closed"
+	if b.State() == StateOpen {
+		state = "open"
+	}
+	return circuitbreaker.Stat{
+		State:   state,
+		Success: success,
+		Total:   total,
+	}
+}
+
+// transit switches the state from one to the other and notifies the
+// callback if this call performed the transition.
+func (b *Breaker) transit(from, to int32) {
+	// avoid the CAS, and its cache line contention, when nothing changes.
+	if atomic.LoadInt32(&b.state) != from {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&b.state, from, to) && b.onStateChange != nil {
+		b.notify()
+	}
+}
+
+// notify starts the goroutine reporting the transitions unless it runs.
+func (b *Breaker) notify() {
+	if atomic.CompareAndSwapInt32(&b.draining, 0, 1) {
+		go b.drain()
+	}
+}
+
+// drain calls the callback until the reported state is the current one,
+// the transitions happening while the callback runs are coalesced, e.g.
+// open to closed and back to open again is not reported at all.
+func (b *Breaker) drain() {
+	for {
+		if state := atomic.LoadInt32(&b.state); state != b.reported {
+			from := b.reported
+			b.reported = state
+			b.onStateChange(b.name, from, state)
+			continue
+		}
+		atomic.StoreInt32(&b.draining, 0)
+		// a transition happened before the store found draining set.
+		if atomic.LoadInt32(&b.state) == b.reported || !atomic.CompareAndSwapInt32(&b.draining, 0, 1) {
+			return
+		}
+	}
+}
+
 // MarkSuccess mark request is success.
 func (b *Breaker) MarkSuccess() {
-	b.stat.Add(1)
+	c := b.acquire()
+	c.stat.Add(1)
+	c.release()
+}
+
+// MarkSuccessWithLatency mark request is success with its latency, a slow
+// request is marked as failed once the slow call ratio is reached.
+func (b *Breaker) MarkSuccessWithLatency(d time.Duration) {
+	c := b.acquire()
+	defer c.release()
+	if c.opts.slowCall <= 0 {
+		c.stat.Add(1)
+		return
+	}
+	slow := d >= c.opts.slowCall
+	if c.slowStat != nil {
+		if !slow {
+			c.slowStat.Add(0)
+			c.stat.Add(1)
+			return
+		}
+		c.slowStat.Add(1)
+		if c.slowStat.Sum() < c.opts.slowRatio*c.slowStat.Reduce(window.Count) {
+			// the slow requests are tolerated below the ratio.
+			c.stat.Add(1)
+			return
+		}
+	}
+	if slow {
+		c.stat.Add(0)
+		return
+	}
+	c.stat.Add(1)
 }
 
 // MarkFailed mark request is failed.
 func (b *Breaker) MarkFailed() {
 	// when client reject request locally, continue to add counter let the drop ratio higher.
-	b.stat.Add(0)
+	c := b.acquire()
+	c.stat.Add(0)
+	c.release()
 }
 
 func (b *Breaker) trueOnProba(proba float64) (truth bool) {
+	if b.r == nil {
+		r := randPool.Get().(*rand.Rand)
+		truth = r.Float64() < proba
+		randPool.Put(r)
+		return
+	}
 	b.randLock.Lock()
 	truth = b.r.Float64() < proba
 	b.randLock.Unlock()
@@ -1,21 +1,25 @@
 package cooh
 
 import (
+	"encoding/json"
 	"math"
 	"math/rand"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/devexps/go-pkg/v2/clock/manual"
+	"github.com/devexps/go-pkg/v2/window"
 	"github.com/stretchr/testify/assert"
 )
 
-func getBreaker() *Breaker {
-	return NewBreaker(
-		WithWindow(time.Millisecond*1000),
+func getBreaker(opts ...Option) *Breaker {
+	return NewBreaker(append([]Option{
+		WithWindow(time.Millisecond * 1000),
 		WithBucket(10),
 		WithRequest(100),
 		WithSuccess(0.5),
-	).(*Breaker)
+	}, opts...)...).(*Breaker)
 	//counterOpts := window.RollingCounterOpts{
 	//	Size:           10,
 	//	BucketDuration: time.Millisecond * 100,
@@ -31,17 +35,17 @@ func getBreaker() *Breaker {
 	//}
 }
 
-func markSuccessWithDuration(b *Breaker, count int, sleep time.Duration) {
+func markSuccessWithDuration(b *Breaker, c *manual.Clock, count int, d time.Duration) {
 	for i := 0; i < count; i++ {
 		b.MarkSuccess()
-		time.Sleep(sleep)
+		c.Advance(d)
 	}
 }
 
-func markFailedWithDuration(b *Breaker, count int, sleep time.Duration) {
+func markFailedWithDuration(b *Breaker, c *manual.Clock, count int, d time.Duration) {
 	for i := 0; i < count; i++ {
 		b.MarkFailed()
-		time.Sleep(sleep)
+		c.Advance(d)
 	}
 }
 
@@ -71,14 +75,14 @@ func testOpen(t *testing.T, b *Breaker) {
 	assert.NotEqual(t, b.Allow(), nil)
 }
 
-func testHalfOpen(t *testing.T, b *Breaker) {
+func testHalfOpen(t *testing.T, b *Breaker, c *manual.Clock) {
 	// failback
 	assert.Equal(t, b.Allow(), nil)
 	t.Run("allow single failed", func(t *testing.T) {
 		markFailed(b, 10000000)
 		assert.NotEqual(t, b.Allow(), nil)
 	})
-	time.Sleep(2 * time.Second)
+	c.Advance(2 * time.Second)
 	t.Run("allow single succeed", func(t *testing.T) {
 		assert.Equal(t, b.Allow(), nil)
 		markSuccess(b, 10000000)
@@ -93,8 +97,77 @@ func Test(t *testing.T) {
 	b = getBreaker()
 	testOpen(t, b)
 
-	b = getBreaker()
-	testHalfOpen(t, b)
+	c := manual.New(time.Now())
+	b = getBreaker(WithClock(c))
+	testHalfOpen(t, b, c)
+}
+
+func TestStateChange(t *testing.T) {
+	type transition struct {
+		name     string
+		from, to int32
+	}
+	transitions := make(chan transition, 2)
+	b := NewBreaker(
+		WithWindow(time.Millisecond*1000),
+		WithBucket(10),
+		WithRequest(100),
+		WithSuccess(0.5),
+		WithName("test"),
+		WithOnStateChange(func(name string, from, to int32) {
+			transitions <- transition{name, from, to}
+		}),
+	).(*Breaker)
+	assert.Equal(t, StateClosed, b.State())
+
+	markSuccess(b, 10)
+	markFailed(b, 200)
+	_ = b.Allow()
+	_ = b.Allow()
+	assert.Equal(t, StateOpen, b.State())
+	assert.Equal(t, transition{"test", StateClosed, StateOpen}, <-transitions)
+
+	markSuccess(b, 1000)
+	_ = b.Allow()
+	_ = b.Allow()
+	assert.Equal(t, StateClosed, b.State())
+	assert.Equal(t, transition{"test", StateOpen, StateClosed}, <-transitions)
+}
+
+func TestStateChangeBlocked(t *testing.T) {
+	type transition struct {
+		from, to int32
+	}
+	release := make(chan struct{})
+	calls := make(chan transition, 3)
+	b := NewBreaker(
+		WithOnStateChange(func(_ string, from, to int32) {
+			calls <- transition{from, to}
+			<-release
+		}),
+	).(*Breaker)
+
+	// the callback blocks on the first transition.
+	b.transit(StateClosed, StateOpen)
+	assert.Equal(t, transition{StateClosed, StateOpen}, <-calls)
+
+	// Allow keeps returning while the callback blocks, without requests
+	// it closes the breaker again.
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, b.Allow())
+		assert.Equal(t, StateClosed, b.State())
+		b.transit(StateClosed, StateOpen)
+	}
+	assert.Nil(t, b.Allow())
+	// the pending transitions are coalesced to the latest state.
+	close(release)
+	assert.Equal(t, transition{StateOpen, StateClosed}, <-calls)
+
+	// back and forth while nothing runs, the callback follows the state.
+	b.transit(StateClosed, StateOpen)
+	assert.Equal(t, transition{StateClosed, StateOpen}, <-calls)
+	time.Sleep(10 * time.Millisecond)
+	assert.Empty(t, calls)
 }
 
 func TestSelfProtection(t *testing.T) {
@@ -116,43 +189,163 @@ func TestSelfProtection(t *testing.T) {
 func TestSummary(t *testing.T) {
 	var (
 		b           *Breaker
+		c           *manual.Clock
 		succ, total int64
 	)
 
-	sleep := 50 * time.Millisecond
+	d := 50 * time.Millisecond
 	t.Run("succ == total", func(t *testing.T) {
-		b = getBreaker()
-		markSuccessWithDuration(b, 10, sleep)
+		c = manual.New(time.Now())
+		b = getBreaker(WithClock(c))
+		markSuccessWithDuration(b, c, 10, d)
 		succ, total = b.summary()
 		assert.Equal(t, succ, int64(10))
 		assert.Equal(t, total, int64(10))
 	})
 
 	t.Run("fail == total", func(t *testing.T) {
-		b = getBreaker()
-		markFailedWithDuration(b, 10, sleep)
+		c = manual.New(time.Now())
+		b = getBreaker(WithClock(c))
+		markFailedWithDuration(b, c, 10, d)
 		succ, total = b.summary()
 		assert.Equal(t, succ, int64(0))
 		assert.Equal(t, total, int64(10))
 	})
 
 	t.Run("succ = 1/2 * total, fail = 1/2 * total", func(t *testing.T) {
-		b = getBreaker()
-		markFailedWithDuration(b, 5, sleep)
-		markSuccessWithDuration(b, 5, sleep)
+		c = manual.New(time.Now())
+		b = getBreaker(WithClock(c))
+		markFailedWithDuration(b, c, 5, d)
+		markSuccessWithDuration(b, c, 5, d)
 		succ, total = b.summary()
 		assert.Equal(t, succ, int64(5))
 		assert.Equal(t, total, int64(10))
 	})
 
 	t.Run("auto reset rolling counter", func(t *testing.T) {
-		time.Sleep(time.Second)
+		c.Advance(time.Second)
 		succ, total = b.summary()
 		assert.Equal(t, succ, int64(0))
 		assert.Equal(t, total, int64(0))
 	})
 }
 
+func TestSlowCall(t *testing.T) {
+	t.Run("threshold", func(t *testing.T) {
+		b := NewBreaker(WithSlowCall(100 * time.Millisecond)).(*Breaker)
+		b.MarkSuccessWithLatency(50 * time.Millisecond)
+		b.MarkSuccessWithLatency(100 * time.Millisecond)
+		b.MarkSuccessWithLatency(time.Second)
+		succ, total := b.summary()
+		assert.Equal(t, int64(1), succ)
+		assert.Equal(t, int64(3), total)
+	})
+
+	t.Run("ratio", func(t *testing.T) {
+		b := NewBreaker(WithSlowCall(100*time.Millisecond), WithSlowCallRatio(0.5)).(*Breaker)
+		for i := 0; i < 3; i++ {
+			b.MarkSuccessWithLatency(50 * time.Millisecond)
+		}
+		// slow ratio: 1/4, 2/5
+		b.MarkSuccessWithLatency(time.Second)
+		b.MarkSuccessWithLatency(time.Second)
+		succ, total := b.summary()
+		assert.Equal(t, int64(5), succ)
+		assert.Equal(t, int64(5), total)
+
+		// slow ratio: 3/6
+		b.MarkSuccessWithLatency(time.Second)
+		succ, total = b.summary()
+		assert.Equal(t, int64(5), succ)
+		assert.Equal(t, int64(6), total)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		b := getBreaker()
+		b.MarkSuccessWithLatency(time.Hour)
+		succ, total := b.summary()
+		assert.Equal(t, int64(1), succ)
+		assert.Equal(t, int64(1), total)
+	})
+}
+
+func TestReconfigure(t *testing.T) {
+	c := manual.New(time.Now())
+	b := getBreaker(WithClock(c))
+	markSuccess(b, 10)
+	markFailed(b, 200)
+	_ = b.Allow()
+	assert.Equal(t, StateOpen, b.State())
+
+	b.Reconfigure(WithRequest(1000))
+	assert.Nil(t, b.Allow())
+	assert.Equal(t, StateClosed, b.State())
+
+	b.Reconfigure(WithRequest(100), WithSuccess(0.01))
+	assert.Nil(t, b.Allow())
+	assert.Equal(t, StateClosed, b.State())
+
+	t.Run("rebuild the window", func(t *testing.T) {
+		b.Reconfigure(WithWindow(2*time.Second), WithBucket(20))
+		succ, total := b.summary()
+		assert.Equal(t, int64(10), succ)
+		assert.Equal(t, int64(210), total)
+
+		c.Advance(time.Second)
+		markSuccess(b, 5)
+		succ, total = b.summary()
+		assert.Equal(t, int64(15), succ)
+		assert.Equal(t, int64(215), total)
+
+		c.Advance(time.Second)
+		succ, total = b.summary()
+		assert.Equal(t, int64(5), succ)
+		assert.Equal(t, int64(5), total)
+	})
+
+	t.Run("concurrent marks", func(t *testing.T) {
+		b := getBreaker(WithClock(manual.New(time.Now())))
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				markSuccess(b, 1000)
+			}()
+		}
+		for i := 0; i < 100; i++ {
+			b.Reconfigure(WithBucket(10 + i%2*10))
+		}
+		wg.Wait()
+		succ, total := b.summary()
+		assert.Equal(t, int64(4000), succ)
+		assert.Equal(t, int64(4000), total)
+	})
+}
+
+func TestInitialState(t *testing.T) {
+	c := manual.New(time.Now())
+	b := getBreaker(WithClock(c))
+	markFailedWithDuration(b, c, 10, 50*time.Millisecond)
+	markSuccessWithDuration(b, c, 10, 50*time.Millisecond)
+
+	data, err := json.Marshal(b.Snapshot())
+	assert.Nil(t, err)
+	var s window.Snapshot
+	assert.Nil(t, json.Unmarshal(data, &s))
+
+	c.Advance(200 * time.Millisecond)
+	restored := getBreaker(WithClock(c), WithInitialState(s))
+	succ, total := restored.summary()
+	assert.Equal(t, int64(10), succ)
+	assert.Equal(t, int64(14), total)
+
+	c.Advance(time.Second)
+	succ, total = restored.summary()
+	assert.Equal(t, int64(0), succ)
+	assert.Equal(t, int64(0), total)
+}
+
 func TestTrueOnProba(t *testing.T) {
 	const proba = math.Pi / 10
 	const total = 100000
@@ -169,6 +362,37 @@ func TestTrueOnProba(t *testing.T) {
 	assert.InEpsilon(t, proba, ratio, epsilon)
 }
 
+func TestTrueOnProbaWithRandSource(t *testing.T) {
+	decisions := func() []bool {
+		b := getBreaker(WithRandSource(rand.NewSource(1)))
+		truths := make([]bool, 100)
+		for i := range truths {
+			truths[i] = b.trueOnProba(0.5)
+		}
+		return truths
+	}
+	assert.Equal(t, decisions(), decisions())
+}
+
+func BenchmarkTrueOnProba(b *testing.B) {
+	b.Run("lock", func(b *testing.B) {
+		breaker := getBreaker(WithRandSource(rand.NewSource(time.Now().UnixNano())))
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_ = breaker.trueOnProba(0.5)
+			}
+		})
+	})
+	b.Run("pool", func(b *testing.B) {
+		breaker := getBreaker()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_ = breaker.trueOnProba(0.5)
+			}
+		})
+	})
+}
+
 func BenchmarkBreakerAllow(b *testing.B) {
 	breaker := getBreaker()
 	b.ResetTimer()
@@ -1,6 +1,12 @@
 package cooh
 
-import "time"
+import (
+	"math/rand"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock"
+	"github.com/devexps/go-pkg/v2/window"
+)
 
 // Option is COOH breaker option function.
 type Option func(*options)
@@ -11,6 +17,16 @@ type options struct {
 	request int64
 	bucket  int
 	window  time.Duration
+
+	slowCall  time.Duration
+	slowRatio float64
+
+	clock   clock.Clock
+	src     rand.Source
+	initial *window.Snapshot
+
+	name          string
+	onStateChange func(name string, from, to int32)
 }
 
 // WithSuccess with the K = 1 / Success value of COOH breaker, default success is 0.5
@@ -42,3 +58,64 @@ func WithBucket(b int) Option {
 		c.bucket = b
 	}
 }
+
+// WithSlowCall with the latency threshold above which a successful request
+// reported by MarkSuccessWithLatency is counted as failed, zero disables it.
+func WithSlowCall(d time.Duration) Option {
+	return func(c *options) {
+		c.slowCall = d
+	}
+}
+
+// WithSlowCallRatio with the ratio of slow requests within the window from
+// which the slow requests are counted as failed, below the ratio they are
+// counted as succeeded. Zero counts every slow request as failed.
+func WithSlowCallRatio(r float64) Option {
+	return func(c *options) {
+		c.slowRatio = r
+	}
+}
+
+// WithClock with the time source of the statistical window,
+// default is the wall clock.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithRandSource with the source of randomness for the drop decisions, the
+// decisions are reproducible for a seeded source used by a single goroutine.
+// By default, a lock free per-P random generator is used.
+func WithRandSource(src rand.Source) Option {
+	return func(o *options) {
+		o.src = src
+	}
+}
+
+// WithInitialState with the statistical window taken by Breaker.Snapshot,
+// e.g. before a restart, the buckets out of the window are dropped.
+func WithInitialState(s window.Snapshot) Option {
+	return func(o *options) {
+		o.initial = &s
+	}
+}
+
+// WithName set the name of the breaker reported to the state change callback.
+func WithName(name string) Option {
+	return func(c *options) {
+		c.name = name
+	}
+}
+
+// WithOnStateChange set the callback invoked on the transitions between
+// StateOpen and StateClosed. It is called in order on a separate goroutine,
+// outside of Allow and Mark, one call at a time. The transitions happening
+// while it runs are coalesced to the latest state: every call reports a
+// change from the state of the previous call, and the last call reports
+// the current state of the breaker.
+func WithOnStateChange(f func(name string, from, to int32)) Option {
+	return func(c *options) {
+		c.onStateChange = f
+	}
+}
@@ -0,0 +1,139 @@
+package circuitbreaker
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+var defaultClassifier = NewClassifier()
+
+// CallOption is Do option function.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	classifier Classifier
+}
+
+// WithClassifier with the Classifier deciding how the result is recorded,
+// default is NewClassifier().
+func WithClassifier(c Classifier) CallOption {
+	return func(o *callOptions) {
+		o.classifier = c
+	}
+}
+
+// Reason is the reason why a fallback is invoked.
+type Reason int
+
+const (
+	// ReasonRejected the call was rejected by the breaker.
+	ReasonRejected Reason = iota
+	// ReasonFailed the call failed.
+	ReasonFailed
+	// ReasonCanceled the context was done before the call.
+	ReasonCanceled
+)
+
+func (r Reason) String() string {
+	switch r {
+	case ReasonRejected:
+		return "rejected"
+	case ReasonFailed:
+		return "failed"
+	case ReasonCanceled:
+		return "canceled"
+	}
+	return fmt.Sprintf("Reason(%d)", int(r))
+}
+
+// FallbackError is the error passed to the fallback function.
+type FallbackError struct {
+	Reason Reason
+	Err    error
+}
+
+func (e *FallbackError) Error() string {
+	return fmt.Sprintf("circuitbreaker: %s: %v", e.Reason, e.Err)
+}
+
+func (e *FallbackError) Unwrap() error {
+	return e.Err
+}
+
+// Do calls fn if the breaker allows it, then marks the breaker with
+// the classified outcome of fn, the latency of fn is reported to breakers
+// implementing LatencyMarker. It returns ErrNotAllowed, or the error
+// of the breaker, when the call is rejected, otherwise the error of fn.
+// A panic in fn is marked as failed and propagated.
+func Do(ctx context.Context, cb CircuitBreaker, fn func(context.Context) error, opts ...CallOption) error {
+	_, err := Execute(ctx, cb, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	}, nil, opts...)
+	return err
+}
+
+// Execute calls primary like Do, and invokes fallback with a *FallbackError
+// when the context is already done, the call is rejected by the breaker or
+// its outcome is a failure, the result of fallback is returned then. A nil
+// fallback returns the error as is.
+func Execute[T any](
+	ctx context.Context,
+	cb CircuitBreaker,
+	primary func(context.Context) (T, error),
+	fallback func(context.Context, error) (T, error),
+	opts ...CallOption,
+) (v T, err error) {
+	o := callOptions{
+		classifier: defaultClassifier,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err = ctx.Err(); err != nil {
+		if fallback == nil {
+			return
+		}
+		return fallback(ctx, &FallbackError{Reason: ReasonCanceled, Err: err})
+	}
+	if err = cb.Allow(); err != nil {
+		if fallback == nil {
+			return
+		}
+		return fallback(ctx, &FallbackError{Reason: ReasonRejected, Err: err})
+	}
+
+	start := time.Now()
+	panicked := true
+	defer func() {
+		if panicked {
+			cb.MarkFailed()
+		}
+	}()
+	v, err = primary(ctx)
+	panicked = false
+
+	outcome := o.classifier(err)
+	mark(cb, outcome, time.Since(start))
+	if outcome == OutcomeFailure && fallback != nil {
+		return fallback(ctx, &FallbackError{Reason: ReasonFailed, Err: err})
+	}
+	return
+}
+
+func mark(cb CircuitBreaker, outcome Outcome, latency time.Duration) {
+	switch outcome {
+	case OutcomeSuccess:
+		if lm, ok := cb.(LatencyMarker); ok {
+			lm.MarkSuccessWithLatency(latency)
+			return
+		}
+		cb.MarkSuccess()
+	case OutcomeFailure:
+		cb.MarkFailed()
+	case OutcomeIgnore:
+		if r, ok := cb.(Releaser); ok {
+			r.Release()
+		}
+	}
+}
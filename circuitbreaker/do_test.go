@@ -0,0 +1,145 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errBadRequest = errors.New("bad request")
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func TestClassifier(t *testing.T) {
+	c := NewClassifier(
+		WithIgnoredErrors(errBadRequest),
+		WithFailurePredicate(func(err error) bool {
+			return err.Error() != "not found"
+		}),
+	)
+	assert.Equal(t, OutcomeSuccess, c(nil))
+	assert.Equal(t, OutcomeIgnore, c(context.Canceled))
+	assert.Equal(t, OutcomeIgnore, c(fmt.Errorf("wrapped: %w", errBadRequest)))
+	assert.Equal(t, OutcomeFailure, c(context.DeadlineExceeded))
+	assert.Equal(t, OutcomeFailure, c(&net.OpError{Op: "dial", Err: timeoutError{}}))
+	assert.Equal(t, OutcomeSuccess, c(errors.New("not found")))
+	assert.Equal(t, OutcomeFailure, c(errors.New("internal")))
+
+	c = NewClassifier(WithSuccessErrors(errBadRequest))
+	assert.Equal(t, OutcomeSuccess, c(fmt.Errorf("wrapped: %w", errBadRequest)))
+	assert.Equal(t, OutcomeFailure, c(errors.New("internal")))
+}
+
+func TestDo(t *testing.T) {
+	ctx := context.Background()
+	t.Run("success", func(t *testing.T) {
+		cb := &testBreaker{}
+		assert.Nil(t, Do(ctx, cb, func(context.Context) error { return nil }))
+		assert.Equal(t, Stat{State: "closed", Success: 1, Total: 1}, cb.Stat())
+	})
+	t.Run("failed", func(t *testing.T) {
+		cb := &testBreaker{}
+		err := errors.New("internal")
+		assert.Equal(t, err, Do(ctx, cb, func(context.Context) error { return err }))
+		assert.Equal(t, Stat{State: "closed", Success: 0, Total: 1}, cb.Stat())
+	})
+	t.Run("ignored", func(t *testing.T) {
+		cb := &testBreaker{}
+		assert.Equal(t, context.Canceled, Do(ctx, cb, func(context.Context) error { return context.Canceled }))
+		assert.Equal(t, Stat{State: "closed"}, cb.Stat())
+	})
+	t.Run("classifier", func(t *testing.T) {
+		cb := &testBreaker{}
+		_ = Do(ctx, cb, func(context.Context) error { return errBadRequest },
+			WithClassifier(NewClassifier(WithSuccessErrors(errBadRequest))))
+		assert.Equal(t, Stat{State: "closed", Success: 1, Total: 1}, cb.Stat())
+	})
+	t.Run("not allowed", func(t *testing.T) {
+		cb := &testBreaker{err: ErrNotAllowed}
+		called := false
+		err := Do(ctx, cb, func(context.Context) error {
+			called = true
+			return nil
+		})
+		assert.Equal(t, ErrNotAllowed, err)
+		assert.False(t, called)
+		assert.Equal(t, Stat{State: "closed"}, cb.Stat())
+	})
+	t.Run("context done", func(t *testing.T) {
+		cb := &testBreaker{}
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		assert.Equal(t, context.Canceled, Do(ctx, cb, func(context.Context) error { return nil }))
+		assert.Equal(t, Stat{State: "closed"}, cb.Stat())
+	})
+}
+
+func TestExecute(t *testing.T) {
+	ctx := context.Background()
+	fallback := func(ctx context.Context, err error) (string, error) {
+		var fe *FallbackError
+		if errors.As(err, &fe) {
+			return "fallback: " + fe.Reason.String(), nil
+		}
+		return "", err
+	}
+	t.Run("success", func(t *testing.T) {
+		cb := &testBreaker{}
+		v, err := Execute(ctx, cb, func(context.Context) (string, error) { return "primary", nil }, fallback)
+		assert.Nil(t, err)
+		assert.Equal(t, "primary", v)
+		assert.Equal(t, Stat{State: "closed", Success: 1, Total: 1}, cb.Stat())
+	})
+	t.Run("rejected", func(t *testing.T) {
+		cb := &testBreaker{err: ErrNotAllowed}
+		var reason error
+		v, err := Execute(ctx, cb, func(context.Context) (string, error) { return "primary", nil },
+			func(ctx context.Context, err error) (string, error) {
+				reason = err
+				return fallback(ctx, err)
+			})
+		assert.Nil(t, err)
+		assert.Equal(t, "fallback: rejected", v)
+		assert.ErrorIs(t, reason, ErrNotAllowed)
+		assert.Equal(t, Stat{State: "closed"}, cb.Stat())
+	})
+	t.Run("failed", func(t *testing.T) {
+		cb := &testBreaker{}
+		v, err := Execute(ctx, cb, func(context.Context) (string, error) { return "", errors.New("internal") }, fallback)
+		assert.Nil(t, err)
+		assert.Equal(t, "fallback: failed", v)
+		assert.Equal(t, Stat{State: "closed", Success: 0, Total: 1}, cb.Stat())
+	})
+	t.Run("ignored", func(t *testing.T) {
+		cb := &testBreaker{}
+		_, err := Execute(ctx, cb, func(context.Context) (string, error) { return "", context.Canceled }, fallback)
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, Stat{State: "closed"}, cb.Stat())
+	})
+	t.Run("canceled", func(t *testing.T) {
+		cb := &testBreaker{}
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		v, err := Execute(ctx, cb, func(context.Context) (string, error) { return "primary", nil }, fallback)
+		assert.Nil(t, err)
+		assert.Equal(t, "fallback: canceled", v)
+		assert.Equal(t, Stat{State: "closed"}, cb.Stat())
+	})
+	t.Run("panic", func(t *testing.T) {
+		cb := &testBreaker{}
+		assert.PanicsWithValue(t, "boom", func() {
+			_, _ = Execute(ctx, cb, func(context.Context) (string, error) { panic("boom") }, fallback)
+		})
+		assert.Equal(t, Stat{State: "closed", Success: 0, Total: 1}, cb.Stat())
+	})
+}
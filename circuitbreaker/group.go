@@ -0,0 +1,165 @@
+package circuitbreaker
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/group"
+)
+
+// Stat is a snapshot of a circuit breaker.
+type Stat struct {
+	State   string
+	Success int64
+	Total   int64
+}
+
+// Stater is implemented by circuit breakers able to report a Stat.
+type Stater interface {
+	Stat() Stat
+}
+
+// Group is a registry of circuit breakers keyed by operation name,
+// each breaker is lazily created on the first use of its key.
+type Group[O any] struct {
+	factory func(opts ...O) CircuitBreaker
+	opts    []O
+	group   *group.Group
+
+	mu        sync.RWMutex
+	overrides map[string][]O
+}
+
+type entry struct {
+	once sync.Once
+	cb   CircuitBreaker
+	// created is set once cb is assigned.
+	created int32
+	// lastUsed is the time of the last Get in nanoseconds, or evicted once
+	// the entry has been deleted by EvictIdle.
+	lastUsed int64
+}
+
+const evicted = -1
+
+// NewGroup returns a breaker registry, the breakers are created by
+// the factory with the given default options, e.g.
+//
+//	g := circuitbreaker.NewGroup(cooh.NewBreaker, cooh.WithRequest(50))
+func NewGroup[O any](factory func(opts ...O) CircuitBreaker, opts ...O) *Group[O] {
+	if factory == nil {
+		panic("circuitbreaker: can't assign a nil to the factory function")
+	}
+	return &Group[O]{
+		factory: factory,
+		opts:    opts,
+		group: group.NewGroup(func() interface{} {
+			// set before the entry is published so it is not idle.
+			return &entry{lastUsed: time.Now().UnixNano()}
+		}),
+		overrides: make(map[string][]O),
+	}
+}
+
+// Get gets the breaker by the given key.
+func (g *Group[O]) Get(key string) CircuitBreaker {
+	for {
+		e := g.group.Get(key).(*entry)
+		if touch(e) {
+			return g.load(key, e)
+		}
+		// lost the race against EvictIdle, the entry is already deleted.
+	}
+}
+
+// touch updates the last use of the entry unless it has been evicted.
+func touch(e *entry) bool {
+	now := time.Now().UnixNano()
+	for {
+		last := atomic.LoadInt64(&e.lastUsed)
+		if last == evicted {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&e.lastUsed, last, now) {
+			return true
+		}
+	}
+}
+
+func (g *Group[O]) load(key string, e *entry) CircuitBreaker {
+	e.once.Do(func() {
+		e.cb = g.factory(g.options(key)...)
+		atomic.StoreInt32(&e.created, 1)
+	})
+	return e.cb
+}
+
+func (g *Group[O]) options(key string) []O {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	overrides := g.overrides[key]
+	opts := make([]O, 0, len(g.opts)+len(overrides))
+	opts = append(opts, g.opts...)
+	return append(opts, overrides...)
+}
+
+// Configure sets the options applied on top of the default options for the
+// given key, an existing breaker of the key is replaced on the next Get.
+func (g *Group[O]) Configure(key string, opts ...O) {
+	g.mu.Lock()
+	if len(opts) == 0 {
+		delete(g.overrides, key)
+	} else {
+		g.overrides[key] = opts
+	}
+	g.mu.Unlock()
+	g.group.Delete(key)
+}
+
+// EvictIdle deletes the breakers which have not been used for the idle
+// duration and returns the number of deleted breakers.
+func (g *Group[O]) EvictIdle(idle time.Duration) int {
+	deadline := time.Now().Add(-idle).UnixNano()
+	var keys []string
+	g.group.Range(func(key string, val interface{}) bool {
+		if atomic.LoadInt64(&val.(*entry).lastUsed) < deadline {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	n := 0
+	for _, key := range keys {
+		// the entry may have been used or replaced since the Range.
+		if g.group.DeleteFunc(key, func(val interface{}) bool {
+			e := val.(*entry)
+			last := atomic.LoadInt64(&e.lastUsed)
+			return last < deadline && atomic.CompareAndSwapInt64(&e.lastUsed, last, evicted)
+		}) {
+			n++
+		}
+	}
+	return n
+}
+
+// Snapshot returns the Stat of every breaker in the registry, breakers which
+// do not implement Stater are reported with a zero Stat. It does not create
+// breakers.
+func (g *Group[O]) Snapshot() map[string]Stat {
+	breakers := make(map[string]CircuitBreaker)
+	g.group.Range(func(key string, val interface{}) bool {
+		if e := val.(*entry); atomic.LoadInt32(&e.created) == 1 {
+			breakers[key] = e.cb
+		}
+		return true
+	})
+	stats := make(map[string]Stat, len(breakers))
+	for key, cb := range breakers {
+		var stat Stat
+		if s, ok := cb.(Stater); ok {
+			stat = s.Stat()
+		}
+		stats[key] = stat
+	}
+	return stats
+}
@@ -0,0 +1,93 @@
+package circuitbreaker
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testBreaker struct {
+	opts    []string
+	err     error
+	success int64
+	total   int64
+}
+
+func newTestBreaker(opts ...string) CircuitBreaker {
+	return &testBreaker{opts: opts}
+}
+
+func (b *testBreaker) Allow() error { return b.err }
+
+func (b *testBreaker) MarkSuccess() {
+	b.success++
+	b.total++
+}
+
+func (b *testBreaker) MarkFailed() { b.total++ }
+
+func (b *testBreaker) Stat() Stat {
+	return Stat{State: "closed", Success: b.success, Total: b.total}
+}
+
+func TestGroupGet(t *testing.T) {
+	g := NewGroup(newTestBreaker, "default")
+	cb := g.Get("key_0")
+	assert.Equal(t, []string{"default"}, cb.(*testBreaker).opts)
+	assert.Same(t, cb, g.Get("key_0"))
+	assert.NotSame(t, cb, g.Get("key_1"))
+}
+
+func TestGroupConfigure(t *testing.T) {
+	g := NewGroup(newTestBreaker, "default")
+	cb := g.Get("key")
+	g.Configure("key", "override")
+	overridden := g.Get("key")
+	assert.NotSame(t, cb, overridden)
+	assert.Equal(t, []string{"default", "override"}, overridden.(*testBreaker).opts)
+	assert.Equal(t, []string{"default"}, g.Get("other").(*testBreaker).opts)
+
+	g.Configure("key")
+	assert.Equal(t, []string{"default"}, g.Get("key").(*testBreaker).opts)
+}
+
+func TestGroupEvictIdle(t *testing.T) {
+	g := NewGroup(newTestBreaker)
+	g.Get("idle")
+	time.Sleep(50 * time.Millisecond)
+	g.Get("used")
+	assert.Equal(t, 1, g.EvictIdle(25*time.Millisecond))
+
+	stats := g.Snapshot()
+	assert.Len(t, stats, 1)
+	assert.Contains(t, stats, "used")
+
+	// a used entry is never deleted, an evicted one is replaced on Get.
+	cb := g.Get("used")
+	e := g.group.Get("used").(*entry)
+	atomic.StoreInt64(&e.lastUsed, 0)
+	assert.Same(t, cb, g.Get("used"))
+	assert.Equal(t, 0, g.EvictIdle(25*time.Millisecond))
+	atomic.StoreInt64(&e.lastUsed, 0)
+	assert.Equal(t, 1, g.EvictIdle(25*time.Millisecond))
+	assert.Equal(t, int64(evicted), atomic.LoadInt64(&e.lastUsed))
+	assert.NotSame(t, cb, g.Get("used"))
+}
+
+func TestGroupSnapshot(t *testing.T) {
+	g := NewGroup(newTestBreaker)
+	g.Get("key_0").MarkSuccess()
+	g.Get("key_0").MarkFailed()
+	g.Get("key_1").MarkFailed()
+	assert.Equal(t, map[string]Stat{
+		"key_0": {State: "closed", Success: 1, Total: 2},
+		"key_1": {State: "closed", Success: 0, Total: 1},
+	}, g.Snapshot())
+
+	// an entry without a breaker yet is not reported, nor created.
+	e := g.group.Get("key_2").(*entry)
+	assert.NotContains(t, g.Snapshot(), "key_2")
+	assert.Nil(t, e.cb)
+}
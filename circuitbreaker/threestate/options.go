@@ -0,0 +1,83 @@
+package threestate
+
+import (
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock"
+)
+
+// Option is three-state breaker option function.
+type Option func(*options)
+
+// options is a breaker options.
+type options struct {
+	failures    int64
+	ratio       float64
+	request     int64
+	bucket      int
+	window      time.Duration
+	openTimeout time.Duration
+	probes      int64
+	clock       clock.Clock
+}
+
+// WithConsecutiveFailures trips the breaker after n consecutive failures,
+// zero disables the condition.
+func WithConsecutiveFailures(n int64) Option {
+	return func(c *options) {
+		c.failures = n
+	}
+}
+
+// WithFailureRatio trips the breaker when the failure ratio within the
+// statistical window reaches r, zero disables the condition.
+func WithFailureRatio(r float64) Option {
+	return func(c *options) {
+		c.ratio = r
+	}
+}
+
+// WithRequest with the minimum number of requests within the window
+// before the failure ratio is taken into account.
+func WithRequest(r int64) Option {
+	return func(c *options) {
+		c.request = r
+	}
+}
+
+// WithWindow with the duration size of the statistical window.
+func WithWindow(d time.Duration) Option {
+	return func(c *options) {
+		c.window = d
+	}
+}
+
+// WithBucket set the bucket number in a window duration.
+func WithBucket(b int) Option {
+	return func(c *options) {
+		c.bucket = b
+	}
+}
+
+// WithOpenTimeout with the duration the breaker stays open before it
+// lets probe requests through.
+func WithOpenTimeout(d time.Duration) Option {
+	return func(c *options) {
+		c.openTimeout = d
+	}
+}
+
+// WithMaxProbes with the number of probe requests allowed in half-open state,
+// the breaker closes once all of them succeed.
+func WithMaxProbes(n int64) Option {
+	return func(c *options) {
+		c.probes = n
+	}
+}
+
+// WithClock with the time source of the breaker, default is the wall clock.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
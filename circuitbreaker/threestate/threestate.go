@@ -0,0 +1,280 @@
+package threestate
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/circuitbreaker"
+	"github.com/devexps/go-pkg/v2/clock"
+	"github.com/devexps/go-pkg/v2/window"
+)
+
+const (
+	// StateClosed when circuit breaker closed, request allowed, the breaker
+	// counts consecutive failures and the failure ratio within the window,
+	// if either of them reaches the setting, then the state is set to open.
+	StateClosed int32 = iota
+
+	// StateOpen when circuit breaker open, request not allowed, after the
+	// open timeout the state is set to half-open.
+	StateOpen
+
+	// StateHalfOpen when circuit breaker half-open, a bounded number of probe
+	// requests are allowed, if all of them succeed then the state is reset to
+	// closed, a single failure sets the state back to open.
+	StateHalfOpen
+)
+
+var (
+	_ circuitbreaker.CircuitBreaker = (*Breaker)(nil)
+	_ circuitbreaker.Stater         = (*Breaker)(nil)
+	_ circuitbreaker.Releaser       = (*Breaker)(nil)
+)
+
+var stateNames = map[int32]string{
+	StateClosed:   "closed",
+	StateOpen:     "open",
+	StateHalfOpen: "half-open",
+}
+
+// Breaker is a classic three-state CircuitBreaker pattern.
+type Breaker struct {
+	mu   sync.Mutex
+	stat window.RollingCounter
+	opts options
+
+	state int32
+	// changedAt is the time of the last transition to open or half-open.
+	changedAt time.Time
+	// consecutive is the number of consecutive failures in closed state.
+	consecutive int64
+	// probes, marked and successes count the probe requests in half-open state.
+	probes    int64
+	marked    int64
+	successes int64
+	// admitted is the number of requests allowed in closed state and not
+	// marked yet, they become stale when the breaker trips.
+	admitted int64
+	// stale is the number of requests allowed before the last trip and not
+	// marked yet, their marks say nothing about the recovery and are ignored.
+	stale int64
+}
+
+// NewBreaker return a three-state Breaker with options
+func NewBreaker(opts ...Option) circuitbreaker.CircuitBreaker {
+	opt := options{
+		failures:    5,
+		ratio:       0.5,
+		request:     20,
+		bucket:      10,
+		window:      10 * time.Second,
+		openTimeout: 5 * time.Second,
+		probes:      3,
+		clock:       clock.New(),
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	if opt.probes < 1 {
+		opt.probes = 1
+	}
+	return &Breaker{
+		stat:  newStat(opt),
+		opts:  opt,
+		state: StateClosed,
+	}
+}
+
+func newStat(opt options) window.RollingCounter {
+	return window.NewRollingCounter(window.RollingCounterOpts{
+		Size:           opt.bucket,
+		BucketDuration: time.Duration(int64(opt.window) / int64(opt.bucket)),
+		Clock:          opt.clock,
+	})
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() int32 {
+	return atomic.LoadInt32(&b.state)
+}
+
+// Stat returns the state and the success/total counts within the window.
+func (b *Breaker) Stat() circuitbreaker.Stat {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	success, total := b.summary()
+	return circuitbreaker.Stat{
+		State:   stateNames[b.state],
+		Success: success,
+		Total:   total,
+	}
+}
+
+func (b *Breaker) summary() (success int64, total int64) {
+	b.stat.Reduce(func(iterator window.Iterator) float64 {
+		for iterator.Next() {
+			bucket := iterator.Bucket()
+			total += bucket.Count
+			for _, p := range bucket.Points {
+				success += int64(p)
+			}
+		}
+		return 0
+	})
+	return
+}
+
+// Allow request if error returns nil.
+func (b *Breaker) Allow() error {
+	if atomic.LoadInt32(&b.state) == StateClosed {
+		atomic.AddInt64(&b.admitted, 1)
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateOpen:
+		if b.opts.clock.Since(b.changedAt) < b.opts.openTimeout {
+			return circuitbreaker.ErrNotAllowed
+		}
+		b.setState(StateHalfOpen)
+	case StateHalfOpen:
+		if b.probes >= b.opts.probes && b.opts.clock.Since(b.changedAt) >= b.opts.openTimeout {
+			// the probes have never been marked, let a new round through,
+			// the requests never marked are not waited for anymore.
+			b.stale = 0
+			b.setState(StateHalfOpen)
+		}
+	default:
+		return nil
+	}
+	if b.probes >= b.opts.probes {
+		return circuitbreaker.ErrNotAllowed
+	}
+	b.probes++
+	return nil
+}
+
+// MarkSuccess mark request is success.
+func (b *Breaker) MarkSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateClosed:
+		b.release()
+		b.consecutive = 0
+		b.stat.Add(1)
+	case StateOpen:
+		b.release()
+	case StateHalfOpen:
+		if !b.markProbe() {
+			return
+		}
+		b.successes++
+		if b.successes >= b.opts.probes {
+			b.setState(StateClosed)
+		}
+	}
+}
+
+// MarkFailed mark request is failed.
+func (b *Breaker) MarkFailed() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateClosed:
+		b.release()
+		b.consecutive++
+		b.stat.Add(0)
+		if b.shouldTrip() {
+			b.setState(StateOpen)
+		}
+	case StateOpen:
+		b.release()
+	case StateHalfOpen:
+		if b.markProbe() {
+			b.setState(StateOpen)
+		}
+	}
+}
+
+// Release gives back an allowed request which is never marked, a probe
+// in half-open state lets another probe through.
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateClosed, StateOpen:
+		b.release()
+	case StateHalfOpen:
+		if b.markProbe() {
+			b.marked--
+			b.probes--
+		}
+	}
+}
+
+// release accounts the mark of a request allowed in closed state,
+// it must be called with b.mu held.
+func (b *Breaker) release() {
+	if b.stale > 0 {
+		b.stale--
+		return
+	}
+	if atomic.LoadInt64(&b.admitted) > 0 {
+		atomic.AddInt64(&b.admitted, -1)
+	}
+}
+
+// markProbe reports whether a mark in half-open state is the result of a probe,
+// the stale marks and the marks beyond the allowed probes are not.
+// It must be called with b.mu held.
+func (b *Breaker) markProbe() bool {
+	if b.stale > 0 {
+		b.stale--
+		return false
+	}
+	if b.marked >= b.probes {
+		return false
+	}
+	b.marked++
+	return true
+}
+
+func (b *Breaker) shouldTrip() bool {
+	if b.opts.failures > 0 && b.consecutive >= b.opts.failures {
+		return true
+	}
+	if b.opts.ratio <= 0 {
+		return false
+	}
+	success, total := b.summary()
+	if total == 0 || total < b.opts.request {
+		return false
+	}
+	return float64(total-success)/float64(total) >= b.opts.ratio
+}
+
+// setState must be called with b.mu held.
+func (b *Breaker) setState(state int32) {
+	switch {
+	case state == StateClosed:
+		b.stale = 0
+	case b.state == StateClosed:
+		b.stale += atomic.SwapInt64(&b.admitted, 0)
+	case b.state == StateHalfOpen && state == StateOpen:
+		b.stale += b.probes - b.marked
+	}
+	b.probes = 0
+	b.marked = 0
+	b.successes = 0
+	if state == StateClosed {
+		b.consecutive = 0
+		b.stat = newStat(b.opts)
+	} else {
+		b.changedAt = b.opts.clock.Now()
+	}
+	atomic.StoreInt32(&b.state, state)
+}
@@ -0,0 +1,191 @@
+package threestate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/circuitbreaker"
+	"github.com/devexps/go-pkg/v2/clock/manual"
+	"github.com/stretchr/testify/assert"
+)
+
+func getBreaker(opts ...Option) *Breaker {
+	return NewBreaker(append([]Option{
+		WithWindow(time.Second),
+		WithBucket(10),
+		WithRequest(10),
+		WithFailureRatio(0.5),
+		WithConsecutiveFailures(5),
+		WithOpenTimeout(100 * time.Millisecond),
+		WithMaxProbes(2),
+	}, opts...)...).(*Breaker)
+}
+
+func markSuccess(b *Breaker, count int) {
+	for i := 0; i < count; i++ {
+		b.MarkSuccess()
+	}
+}
+
+func markFailed(b *Breaker, count int) {
+	for i := 0; i < count; i++ {
+		b.MarkFailed()
+	}
+}
+
+func TestConsecutiveFailures(t *testing.T) {
+	b := getBreaker()
+	markFailed(b, 4)
+	assert.Equal(t, StateClosed, b.State())
+	assert.Nil(t, b.Allow())
+
+	markSuccess(b, 1)
+	markFailed(b, 4)
+	assert.Equal(t, StateClosed, b.State())
+
+	markFailed(b, 1)
+	assert.Equal(t, StateOpen, b.State())
+	assert.Equal(t, circuitbreaker.ErrNotAllowed, b.Allow())
+	assert.Equal(t, circuitbreaker.Stat{State: "open", Success: 1, Total: 10}, b.Stat())
+}
+
+func TestFailureRatio(t *testing.T) {
+	t.Run("below the minimum request", func(t *testing.T) {
+		b := getBreaker(WithConsecutiveFailures(0))
+		for i := 0; i < 4; i++ {
+			b.MarkSuccess()
+			b.MarkFailed()
+		}
+		assert.Equal(t, StateClosed, b.State())
+	})
+	t.Run("ratio reached", func(t *testing.T) {
+		b := getBreaker(WithConsecutiveFailures(0))
+		for i := 0; i < 5; i++ {
+			b.MarkSuccess()
+			b.MarkFailed()
+		}
+		assert.Equal(t, StateOpen, b.State())
+	})
+	t.Run("ratio not reached", func(t *testing.T) {
+		b := getBreaker(WithConsecutiveFailures(0))
+		markSuccess(b, 10)
+		markFailed(b, 9)
+		assert.Equal(t, StateClosed, b.State())
+	})
+}
+
+func TestHalfOpen(t *testing.T) {
+	t.Run("probes succeed", func(t *testing.T) {
+		c := manual.New(time.Now())
+		b := getBreaker(WithClock(c))
+		markFailed(b, 5)
+		assert.Equal(t, circuitbreaker.ErrNotAllowed, b.Allow())
+
+		c.Advance(100 * time.Millisecond)
+		assert.Nil(t, b.Allow())
+		assert.Equal(t, StateHalfOpen, b.State())
+		assert.Nil(t, b.Allow())
+		assert.Equal(t, circuitbreaker.ErrNotAllowed, b.Allow())
+
+		b.MarkSuccess()
+		assert.Equal(t, StateHalfOpen, b.State())
+		b.MarkSuccess()
+		assert.Equal(t, StateClosed, b.State())
+		assert.Nil(t, b.Allow())
+
+		success, total := b.summary()
+		assert.Equal(t, int64(0), success)
+		assert.Equal(t, int64(0), total)
+	})
+	t.Run("probe fails", func(t *testing.T) {
+		c := manual.New(time.Now())
+		b := getBreaker(WithClock(c))
+		markFailed(b, 5)
+		c.Advance(100 * time.Millisecond)
+		assert.Nil(t, b.Allow())
+		b.MarkFailed()
+		assert.Equal(t, StateOpen, b.State())
+		assert.Equal(t, circuitbreaker.ErrNotAllowed, b.Allow())
+	})
+	t.Run("stale marks", func(t *testing.T) {
+		c := manual.New(time.Now())
+		b := getBreaker(WithClock(c))
+		for i := 0; i < 6; i++ {
+			assert.Nil(t, b.Allow())
+		}
+		markFailed(b, 5)
+		assert.Equal(t, StateOpen, b.State())
+		c.Advance(100 * time.Millisecond)
+		assert.Nil(t, b.Allow())
+		// the marks of the requests allowed before the trip, or beyond
+		// the allowed probes, do not close the breaker.
+		markSuccess(b, 3)
+		assert.Equal(t, StateHalfOpen, b.State())
+		assert.Nil(t, b.Allow())
+		b.MarkSuccess()
+		assert.Equal(t, StateClosed, b.State())
+	})
+	t.Run("ignored outcomes", func(t *testing.T) {
+		c := manual.New(time.Now())
+		b := getBreaker(WithClock(c), WithMaxProbes(1))
+		ctx := context.Background()
+		for i := 0; i < 3; i++ {
+			err := circuitbreaker.Do(ctx, b, func(context.Context) error {
+				return context.Canceled
+			})
+			assert.Equal(t, context.Canceled, err)
+		}
+		errTest := errors.New("test")
+		for i := 0; i < 5; i++ {
+			err := circuitbreaker.Do(ctx, b, func(context.Context) error {
+				return errTest
+			})
+			assert.Equal(t, errTest, err)
+		}
+		assert.Equal(t, StateOpen, b.State())
+		c.Advance(100 * time.Millisecond)
+		// the released requests do not swallow the probe.
+		assert.Nil(t, circuitbreaker.Do(ctx, b, func(context.Context) error {
+			return nil
+		}))
+		assert.Equal(t, StateClosed, b.State())
+	})
+	t.Run("released probe", func(t *testing.T) {
+		c := manual.New(time.Now())
+		b := getBreaker(WithClock(c), WithMaxProbes(1))
+		markFailed(b, 5)
+		c.Advance(100 * time.Millisecond)
+		assert.Nil(t, b.Allow())
+		assert.Equal(t, circuitbreaker.ErrNotAllowed, b.Allow())
+		b.Release()
+		assert.Nil(t, b.Allow())
+		b.MarkSuccess()
+		assert.Equal(t, StateClosed, b.State())
+	})
+	t.Run("probes never marked", func(t *testing.T) {
+		c := manual.New(time.Now())
+		b := getBreaker(WithClock(c))
+		markFailed(b, 5)
+		c.Advance(100 * time.Millisecond)
+		assert.Nil(t, b.Allow())
+		assert.Nil(t, b.Allow())
+		assert.Equal(t, circuitbreaker.ErrNotAllowed, b.Allow())
+		c.Advance(100 * time.Millisecond)
+		assert.Nil(t, b.Allow())
+	})
+}
+
+func BenchmarkBreakerAllow(b *testing.B) {
+	breaker := getBreaker()
+	b.ResetTimer()
+	for i := 0; i <= b.N; i++ {
+		_ = breaker.Allow()
+		if i%2 == 0 {
+			breaker.MarkSuccess()
+		} else {
+			breaker.MarkFailed()
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package clock
+
+import "time"
+
+// Clock tells the current time, it allows the time dependent
+// components to run on a time source other than the wall clock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// Since returns the time elapsed since t.
+	Since(t time.Time) time.Duration
+}
+
+var _ Clock = realClock{}
+
+type realClock struct{}
+
+// New returns a Clock reading the wall clock.
+func New() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
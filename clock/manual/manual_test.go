@@ -0,0 +1,24 @@
+package manual
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	c := New(start)
+	assert.Equal(t, start, c.Now())
+
+	c.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Second), c.Now())
+	assert.Equal(t, time.Second, c.Since(start))
+
+	c.Advance(-2 * time.Second)
+	assert.Equal(t, -time.Second, c.Since(start))
+
+	c.Set(start)
+	assert.Equal(t, time.Duration(0), c.Since(start))
+}
@@ -0,0 +1,129 @@
+package cpu
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrInvalidInterval is returned by Start when the interval is not positive.
+var ErrInvalidInterval = errors.New("cpu: sampler interval must be positive")
+
+// Sampler samples the cpu usage periodically and keeps its exponentially
+// weighted moving average, usage = usageᵗ⁻¹ * decay + usageᵗ * (1 - decay).
+type Sampler struct {
+	interval time.Duration
+	decay    float64
+	// usage is the bits of the float64 average.
+	usage uint64
+
+	mu    sync.Mutex
+	stats CPU
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewSampler returns a Sampler reading the cpu every interval, a decay
+// outside [0, 1) is zero which keeps the last sample only. A non positive
+// interval fails Start with ErrInvalidInterval.
+func NewSampler(interval time.Duration, decay float64) *Sampler {
+	if decay < 0 || decay >= 1 {
+		decay = 0
+	}
+	return &Sampler{
+		interval: interval,
+		decay:    decay,
+	}
+}
+
+// Start starts sampling in a goroutine, it reads the cgroup of the process
+// or falls back to psutil, and fails if neither works. Starting a started
+// Sampler does nothing.
+func (s *Sampler) Start() error {
+	if s.interval <= 0 {
+		return ErrInvalidInterval
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return nil
+	}
+	if s.stats == nil {
+		stats, err := newCPU(s.interval)
+		if err != nil {
+			return err
+		}
+		s.stats = stats
+	}
+	s.stop, s.done = make(chan struct{}), make(chan struct{})
+	go s.run(s.stats, s.stop, s.done)
+	return nil
+}
+
+// Stop stops sampling and waits for the goroutine to exit, the last
+// usage is kept.
+func (s *Sampler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop, s.done = nil, nil
+}
+
+// Usage returns the moving average of the cpu usage in per mille,
+// zero before the first sample.
+func (s *Sampler) Usage() uint64 {
+	return uint64(math.Float64frombits(atomic.LoadUint64(&s.usage)))
+}
+
+// Info returns the cpu info, zero if the Sampler never started.
+func (s *Sampler) Info() Info {
+	s.mu.Lock()
+	stats := s.stats
+	s.mu.Unlock()
+	if stats == nil {
+		return Info{}
+	}
+	return stats.Info()
+}
+
+func (s *Sampler) run(stats CPU, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		u, err := stats.Usage()
+		if err != nil || u == 0 {
+			continue
+		}
+		prev := math.Float64frombits(atomic.LoadUint64(&s.usage))
+		cur := float64(u)
+		if prev != 0 {
+			cur = prev*s.decay + cur*(1-s.decay)
+		}
+		atomic.StoreUint64(&s.usage, math.Float64bits(cur))
+	}
+}
+
+func newCPU(interval time.Duration) (CPU, error) {
+	stats, err := newCgroupCPU()
+	if err == nil {
+		return stats, nil
+	}
+	ps, psErr := newPsutilCPU(interval)
+	if psErr != nil {
+		return nil, fmt.Errorf("cpu: cgroup cpu init failed: %v, psutil cpu init failed: %v", err, psErr)
+	}
+	return ps, nil
+}
@@ -0,0 +1,62 @@
+package cpu
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeCPU struct {
+	mu    sync.Mutex
+	usage []uint64
+}
+
+func (c *fakeCPU) Usage() (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.usage) == 0 {
+		return 0, errors.New("no sample")
+	}
+	u := c.usage[0]
+	c.usage = c.usage[1:]
+	return u, nil
+}
+
+func (c *fakeCPU) Info() Info {
+	return Info{Frequency: 1000, Quota: 2}
+}
+
+func TestSampler(t *testing.T) {
+	s := NewSampler(time.Millisecond, 0.5)
+	s.stats = &fakeCPU{usage: []uint64{400, 0, 800}}
+	assert.Equal(t, Info{Frequency: 1000, Quota: 2}, s.Info())
+	assert.Nil(t, s.Start())
+	assert.Nil(t, s.Start())
+	assert.Eventually(t, func() bool {
+		return s.Usage() == 600
+	}, time.Second, time.Millisecond)
+
+	s.Stop()
+	s.Stop()
+	// the usage is kept once stopped.
+	assert.Equal(t, uint64(600), s.Usage())
+}
+
+func TestSamplerInvalidInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		s := NewSampler(interval, 0.8)
+		s.stats = &fakeCPU{}
+		assert.Equal(t, ErrInvalidInterval, s.Start())
+		// never started, stopping does nothing.
+		s.Stop()
+	}
+}
+
+func TestSamplerInvalidDecay(t *testing.T) {
+	for _, decay := range []float64{-1, 1} {
+		assert.Equal(t, 0.0, NewSampler(time.Second, decay).decay)
+	}
+}
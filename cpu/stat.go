@@ -1,8 +1,7 @@
 package cpu
 
 import (
-	"fmt"
-	"sync/atomic"
+	"sync"
 	"time"
 )
 
@@ -11,8 +10,9 @@ const (
 )
 
 var (
-	stats CPU
-	usage uint64
+	defaultSampler *Sampler
+	defaultErr     error
+	defaultOnce    sync.Once
 )
 
 // CPU is cpu stat usage.
@@ -21,29 +21,14 @@ type CPU interface {
 	Info() Info
 }
 
-func init() {
-	var (
-		err error
-	)
-	stats, err = newCgroupCPU()
-	if err != nil {
-		// fmt.Printf("cgroup cpu init failed(%v),switch to psutil cpu\n", err)
-		stats, err = newPsutilCPU(interval)
-		if err != nil {
-			panic(fmt.Sprintf("cgroup cpu init failed!err:=%v", err))
-		}
-	}
-	go func() {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
-		for {
-			<-ticker.C
-			u, err := stats.Usage()
-			if err == nil && u != 0 {
-				atomic.StoreUint64(&usage, u)
-			}
-		}
-	}()
+// DefaultSampler returns the Sampler of ReadStat and GetInfo, it is
+// started on the first call and keeps the last sample only.
+func DefaultSampler() (*Sampler, error) {
+	defaultOnce.Do(func() {
+		defaultSampler = NewSampler(interval, 0)
+		defaultErr = defaultSampler.Start()
+	})
+	return defaultSampler, defaultErr
 }
 
 // Stat cpu stat.
@@ -59,10 +44,12 @@ type Info struct {
 
 // ReadStat read cpu stat.
 func ReadStat(stat *Stat) {
-	stat.Usage = atomic.LoadUint64(&usage)
+	s, _ := DefaultSampler()
+	stat.Usage = s.Usage()
 }
 
 // GetInfo get cpu info.
 func GetInfo() Info {
-	return stats.Info()
+	s, _ := DefaultSampler()
+	return s.Info()
 }
@@ -42,6 +42,40 @@ func (g *Group) Get(key string) interface{} {
 	return v
 }
 
+// Delete deletes the object by the given key.
+func (g *Group) Delete(key string) {
+	g.Lock()
+	delete(g.vals, key)
+	g.Unlock()
+}
+
+// DeleteFunc deletes the object by the given key if f returns true for it,
+// and reports whether it was deleted. f is called with the group locked and
+// must not call the other methods of the group.
+func (g *Group) DeleteFunc(key string, f func(val interface{}) bool) bool {
+	g.Lock()
+	defer g.Unlock()
+	v, ok := g.vals[key]
+	if !ok || !f(v) {
+		return false
+	}
+	delete(g.vals, key)
+	return true
+}
+
+// Range calls f sequentially for each key and object present in the group,
+// if f returns false, range stops the iteration. f must not call the other
+// methods of the group.
+func (g *Group) Range(f func(key string, val interface{}) bool) {
+	g.RLock()
+	defer g.RUnlock()
+	for k, v := range g.vals {
+		if !f(k, v) {
+			return
+		}
+	}
+}
+
 // Reset resets the new function and deletes all existing objects.
 func (g *Group) Reset(new func() interface{}) {
 	if new == nil {
@@ -77,3 +77,65 @@ func TestGroupClear(t *testing.T) {
 		t.Errorf("expect length 0, actual %v", length)
 	}
 }
+
+func TestGroupDelete(t *testing.T) {
+	count := 0
+	g := NewGroup(func() interface{} {
+		count++
+		return count
+	})
+	g.Get("key")
+	g.Delete("key")
+	if _, ok := g.vals["key"]; ok {
+		t.Errorf("expect key deleted")
+	}
+
+	v := g.Get("key")
+	if !reflect.DeepEqual(v.(int), 2) {
+		t.Errorf("expect 2, actual %v", v)
+	}
+}
+
+func TestGroupDeleteFunc(t *testing.T) {
+	g := NewGroup(func() interface{} {
+		return 1
+	})
+	g.Get("key")
+	if g.DeleteFunc("key", func(val interface{}) bool { return val.(int) == 2 }) {
+		t.Errorf("expect key kept")
+	}
+	if !g.DeleteFunc("key", func(val interface{}) bool { return val.(int) == 1 }) {
+		t.Errorf("expect key deleted")
+	}
+	if _, ok := g.vals["key"]; ok {
+		t.Errorf("expect key deleted")
+	}
+	if g.DeleteFunc("missing", func(interface{}) bool { return true }) {
+		t.Errorf("expect missing key not deleted")
+	}
+}
+
+func TestGroupRange(t *testing.T) {
+	g := NewGroup(func() interface{} {
+		return 1
+	})
+	g.Get("key_0")
+	g.Get("key_1")
+	vals := make(map[string]interface{})
+	g.Range(func(key string, val interface{}) bool {
+		vals[key] = val
+		return true
+	})
+	if !reflect.DeepEqual(vals, map[string]interface{}{"key_0": 1, "key_1": 1}) {
+		t.Errorf("expect all the keys, actual %v", vals)
+	}
+
+	calls := 0
+	g.Range(func(key string, val interface{}) bool {
+		calls++
+		return false
+	})
+	if !reflect.DeepEqual(calls, 1) {
+		t.Errorf("expect calls 1, actual %v", calls)
+	}
+}
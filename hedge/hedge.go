@@ -0,0 +1,150 @@
+package hedge
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/circuitbreaker"
+	"github.com/devexps/go-pkg/v2/clock"
+)
+
+// Hedger issues hedged requests once an attempt takes longer than
+// a percentile of the recent latencies, it is meant for idempotent calls.
+type Hedger struct {
+	hist *histogram
+	opts options
+}
+
+// New returns a Hedger with options.
+func New(opts ...Option) *Hedger {
+	opt := options{
+		percentile:   0.95,
+		maxHedges:    1,
+		minSamples:   100,
+		defaultDelay: 100 * time.Millisecond,
+		minDelay:     time.Millisecond,
+		bucket:       10,
+		window:       10 * time.Second,
+		clock:        clock.New(),
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	return &Hedger{
+		hist: newHistogram(opt.bucket, time.Duration(int64(opt.window)/int64(opt.bucket)), opt.clock),
+		opts: opt,
+	}
+}
+
+// Delay returns the current hedge delay.
+func (h *Hedger) Delay() time.Duration {
+	delay, ok := h.hist.quantile(h.opts.percentile, h.opts.minSamples)
+	if !ok {
+		delay = h.opts.defaultDelay
+	}
+	if delay < h.opts.minDelay {
+		delay = h.opts.minDelay
+	}
+	if h.opts.maxDelay > 0 && delay > h.opts.maxDelay {
+		delay = h.opts.maxDelay
+	}
+	return delay
+}
+
+// Observe adds a latency sample, Do adds the latency of the first attempt
+// of every call.
+func (h *Hedger) Observe(d time.Duration) {
+	h.hist.add(d)
+}
+
+type result[T any] struct {
+	v   T
+	err error
+	// panicked is set with the value of a panic in the attempt.
+	panicked  bool
+	recovered interface{}
+}
+
+// Do calls fn and issues a hedge every hedge delay, at most max hedges times,
+// until an attempt succeeds. A failed attempt issues the next hedge at once.
+// The first successful result is returned and the other attempts are
+// canceled through their context, if all attempts fail the last error is
+// returned. A panic in an attempt is propagated to the caller of Do unless
+// Do has already returned.
+func Do[T any](ctx context.Context, h *Hedger, fn func(context.Context) (T, error)) (T, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan result[T], h.opts.maxHedges+1)
+	// won is set once an attempt succeeded and the others are canceled.
+	var won int32
+	attempts, pending := 0, 0
+	launch := func() {
+		attempts++
+		pending++
+		primary := attempts == 1
+		go func() {
+			panicked := true
+			defer func() {
+				if panicked {
+					results <- result[T]{panicked: true, recovered: recover()}
+				}
+			}()
+			start := h.opts.clock.Now()
+			v, err := call(ctx, h.opts.breaker, fn)
+			// only the first attempt is observed, its latency is not cut
+			// short by the hedge delay. Canceled by a winning hedge, it
+			// lasted at least as long as the call.
+			if primary && (err == nil || atomic.LoadInt32(&won) == 1) {
+				h.Observe(h.opts.clock.Since(start))
+			}
+			panicked = false
+			results <- result[T]{v: v, err: err}
+		}()
+	}
+
+	launch()
+	delay := h.Delay()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var lastErr error
+	for {
+		select {
+		case r := <-results:
+			pending--
+			if r.panicked {
+				panic(r.recovered)
+			}
+			if r.err == nil {
+				// set before the deferred cancel.
+				atomic.StoreInt32(&won, 1)
+				return r.v, nil
+			}
+			lastErr = r.err
+			if attempts <= h.opts.maxHedges {
+				launch()
+			} else if pending == 0 {
+				var zero T
+				return zero, lastErr
+			}
+		case <-timer.C:
+			if attempts <= h.opts.maxHedges {
+				launch()
+				timer.Reset(delay)
+			}
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// call runs a single attempt through the breaker if any, the canceled
+// attempts are not recorded by the breaker.
+func call[T any](ctx context.Context, cb circuitbreaker.CircuitBreaker, fn func(context.Context) (T, error)) (T, error) {
+	if cb == nil {
+		return fn(ctx)
+	}
+	return circuitbreaker.Execute(ctx, cb, fn, nil)
+}
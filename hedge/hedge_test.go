@@ -0,0 +1,147 @@
+package hedge
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/circuitbreaker"
+	"github.com/devexps/go-pkg/v2/circuitbreaker/threestate"
+	"github.com/devexps/go-pkg/v2/clock"
+	"github.com/devexps/go-pkg/v2/clock/manual"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramQuantile(t *testing.T) {
+	h := newHistogram(10, time.Second, clock.New())
+	_, ok := h.quantile(0.95, 1)
+	assert.False(t, ok)
+
+	for i := 1; i <= 100; i++ {
+		h.add(time.Duration(i) * time.Millisecond)
+	}
+	_, ok = h.quantile(0.95, 101)
+	assert.False(t, ok)
+
+	p95, ok := h.quantile(0.95, 100)
+	assert.True(t, ok)
+	assert.GreaterOrEqual(t, p95, 95*time.Millisecond)
+	assert.LessOrEqual(t, p95, time.Duration(95*histogramFactor*float64(time.Millisecond)))
+
+	p50, _ := h.quantile(0.5, 100)
+	assert.GreaterOrEqual(t, p50, 50*time.Millisecond)
+	assert.LessOrEqual(t, p50, time.Duration(50*histogramFactor*float64(time.Millisecond)))
+
+	h.add(time.Hour)
+	p100, _ := h.quantile(1, 100)
+	assert.Equal(t, h.bounds[len(h.bounds)-1], p100)
+}
+
+func TestHistogramQuantileCache(t *testing.T) {
+	c := manual.New(time.Now())
+	h := newHistogram(10, time.Second, c)
+	for i := 0; i < 10; i++ {
+		h.add(time.Millisecond)
+	}
+	p50, ok := h.quantile(0.5, 10)
+	assert.True(t, ok)
+	assert.Equal(t, time.Millisecond, p50.Round(time.Millisecond))
+
+	for i := 0; i < 100; i++ {
+		h.add(time.Second)
+	}
+	p50, _ = h.quantile(0.5, 10)
+	assert.Equal(t, time.Millisecond, p50.Round(time.Millisecond))
+	p90, _ := h.quantile(0.9, 10)
+	assert.GreaterOrEqual(t, p90, time.Second)
+
+	c.Advance(time.Second)
+	p50, _ = h.quantile(0.5, 10)
+	assert.GreaterOrEqual(t, p50, time.Second)
+}
+
+func TestDelay(t *testing.T) {
+	h := New(WithDefaultDelay(50*time.Millisecond), WithMinSamples(10), WithMaxDelay(time.Second))
+	assert.Equal(t, 50*time.Millisecond, h.Delay())
+	for i := 0; i < 10; i++ {
+		h.Observe(time.Hour)
+	}
+	assert.Equal(t, time.Second, h.Delay())
+}
+
+func TestDo(t *testing.T) {
+	ctx := context.Background()
+	t.Run("hedge wins", func(t *testing.T) {
+		h := New(WithDefaultDelay(10 * time.Millisecond))
+		var attempts int32
+		canceled := make(chan struct{})
+		v, err := Do(ctx, h, func(ctx context.Context) (int, error) {
+			n := atomic.AddInt32(&attempts, 1)
+			if n == 1 {
+				<-ctx.Done()
+				close(canceled)
+				return 0, ctx.Err()
+			}
+			return int(n), nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, v)
+		<-canceled
+		// the canceled first attempt is observed, not the hedge.
+		var d time.Duration
+		assert.Eventually(t, func() bool {
+			var ok bool
+			d, ok = h.hist.compute(1, 1)
+			return ok
+		}, time.Second, time.Millisecond)
+		assert.GreaterOrEqual(t, d, 10*time.Millisecond)
+	})
+	t.Run("max hedges", func(t *testing.T) {
+		h := New(WithDefaultDelay(time.Millisecond), WithMaxHedges(2))
+		var attempts int32
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err := Do(ctx, h, func(ctx context.Context) (int, error) {
+			atomic.AddInt32(&attempts, 1)
+			<-ctx.Done()
+			return 0, ctx.Err()
+		})
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+	})
+	t.Run("all failed", func(t *testing.T) {
+		h := New(WithDefaultDelay(time.Hour), WithMaxHedges(2))
+		var attempts int32
+		errTest := errors.New("test")
+		_, err := Do(ctx, h, func(ctx context.Context) (int, error) {
+			atomic.AddInt32(&attempts, 1)
+			return 0, errTest
+		})
+		assert.Equal(t, errTest, err)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+	})
+	t.Run("panic", func(t *testing.T) {
+		h := New(WithDefaultDelay(time.Millisecond))
+		var attempts int32
+		assert.PanicsWithValue(t, "attempt", func() {
+			_, _ = Do(ctx, h, func(ctx context.Context) (int, error) {
+				if atomic.AddInt32(&attempts, 1) == 2 {
+					panic("attempt")
+				}
+				<-ctx.Done()
+				return 0, ctx.Err()
+			})
+		})
+	})
+	t.Run("breaker", func(t *testing.T) {
+		cb := threestate.NewBreaker(threestate.WithConsecutiveFailures(1))
+		cb.MarkFailed()
+		h := New(WithBreaker(cb))
+		_, err := Do(ctx, h, func(ctx context.Context) (int, error) {
+			return 1, nil
+		})
+		assert.Equal(t, circuitbreaker.ErrNotAllowed, err)
+	})
+}
@@ -0,0 +1,104 @@
+package hedge
+
+import (
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock"
+	"github.com/devexps/go-pkg/v2/window"
+)
+
+const (
+	histogramMin    = 100 * time.Microsecond
+	histogramMax    = 60 * time.Second
+	histogramFactor = 1.2
+)
+
+// histogram is a latency histogram over a rolling window, the samples of
+// every latency range are counted by a window.RollingCounter.
+type histogram struct {
+	// bounds are the inclusive upper bounds of the ranges, the last range
+	// counts the samples above the last bound too.
+	bounds   []time.Duration
+	counters []window.RollingCounter
+
+	bucketDuration time.Duration
+	clock          clock.Clock
+	// cached holds the *cachedQuantile computed last.
+	cached atomic.Value
+}
+
+// cachedQuantile is a quantile computed during the bucket tick.
+type cachedQuantile struct {
+	tick       int64
+	q          float64
+	minSamples int64
+	d          time.Duration
+}
+
+func newHistogram(size int, bucketDuration time.Duration, c clock.Clock) *histogram {
+	h := &histogram{
+		bucketDuration: bucketDuration,
+		clock:          c,
+	}
+	for b := float64(histogramMin); b < float64(histogramMax)*histogramFactor; b *= histogramFactor {
+		h.bounds = append(h.bounds, time.Duration(b))
+		h.counters = append(h.counters, window.NewRollingCounter(window.RollingCounterOpts{
+			Size:           size,
+			BucketDuration: bucketDuration,
+			Clock:          c,
+		}))
+	}
+	return h
+}
+
+// add adds a latency sample.
+func (h *histogram) add(d time.Duration) {
+	i := sort.Search(len(h.bounds), func(i int) bool {
+		return h.bounds[i] >= d
+	})
+	if i >= len(h.counters) {
+		i = len(h.counters) - 1
+	}
+	h.counters[i].Add(1)
+}
+
+// quantile returns the upper bound of the range containing the q quantile,
+// ok is false if the window holds less than minSamples samples. The result
+// is computed once per bucket tick, the samples added during the tick are
+// taken into account from the next one.
+func (h *histogram) quantile(q float64, minSamples int64) (d time.Duration, ok bool) {
+	tick := h.clock.Now().UnixNano() / int64(h.bucketDuration)
+	if c, _ := h.cached.Load().(*cachedQuantile); c != nil && c.tick == tick && c.q == q && c.minSamples == minSamples {
+		return c.d, true
+	}
+	d, ok = h.compute(q, minSamples)
+	// not cached below minSamples, so the first samples count at once.
+	if ok {
+		h.cached.Store(&cachedQuantile{tick: tick, q: q, minSamples: minSamples, d: d})
+	}
+	return d, ok
+}
+
+func (h *histogram) compute(q float64, minSamples int64) (d time.Duration, ok bool) {
+	counts := make([]int64, len(h.counters))
+	var total int64
+	for i, c := range h.counters {
+		counts[i] = c.Value()
+		total += counts[i]
+	}
+	if total == 0 || total < minSamples {
+		return 0, false
+	}
+	target := int64(math.Ceil(q * float64(total)))
+	var cumulative int64
+	for i, n := range counts {
+		cumulative += n
+		if cumulative >= target {
+			return h.bounds[i], true
+		}
+	}
+	return h.bounds[len(h.bounds)-1], true
+}
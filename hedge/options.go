@@ -0,0 +1,99 @@
+package hedge
+
+import (
+	"time"
+
+	"github.com/devexps/go-pkg/v2/circuitbreaker"
+	"github.com/devexps/go-pkg/v2/clock"
+)
+
+// Option is hedger option function.
+type Option func(*options)
+
+// options is a hedger options.
+type options struct {
+	percentile   float64
+	maxHedges    int
+	minSamples   int64
+	defaultDelay time.Duration
+	minDelay     time.Duration
+	maxDelay     time.Duration
+	bucket       int
+	window       time.Duration
+	breaker      circuitbreaker.CircuitBreaker
+	clock        clock.Clock
+}
+
+// WithPercentile with the latency percentile after which a hedge is issued,
+// default is 0.95.
+func WithPercentile(p float64) Option {
+	return func(o *options) {
+		o.percentile = p
+	}
+}
+
+// WithMaxHedges with the maximum number of hedges issued on top of
+// the first attempt.
+func WithMaxHedges(n int) Option {
+	return func(o *options) {
+		o.maxHedges = n
+	}
+}
+
+// WithMinSamples with the number of latency samples required within
+// the window before the percentile is used as the hedge delay.
+func WithMinSamples(n int64) Option {
+	return func(o *options) {
+		o.minSamples = n
+	}
+}
+
+// WithDefaultDelay with the hedge delay used until enough samples are taken.
+func WithDefaultDelay(d time.Duration) Option {
+	return func(o *options) {
+		o.defaultDelay = d
+	}
+}
+
+// WithMinDelay with the lower bound of the hedge delay.
+func WithMinDelay(d time.Duration) Option {
+	return func(o *options) {
+		o.minDelay = d
+	}
+}
+
+// WithMaxDelay with the upper bound of the hedge delay, zero is unbounded.
+func WithMaxDelay(d time.Duration) Option {
+	return func(o *options) {
+		o.maxDelay = d
+	}
+}
+
+// WithWindow with the duration size of the latency window.
+func WithWindow(d time.Duration) Option {
+	return func(o *options) {
+		o.window = d
+	}
+}
+
+// WithBucket set the bucket number in a window duration.
+func WithBucket(b int) Option {
+	return func(o *options) {
+		o.bucket = b
+	}
+}
+
+// WithBreaker with the circuit breaker every attempt goes through.
+func WithBreaker(cb circuitbreaker.CircuitBreaker) Option {
+	return func(o *options) {
+		o.breaker = cb
+	}
+}
+
+// WithClock with the time source of the latency window,
+// default is the wall clock.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
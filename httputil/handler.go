@@ -0,0 +1,223 @@
+package httputil
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+)
+
+// errPanic is reported to the rate limiter when the handler or the next
+// transport panics.
+var errPanic = errors.New("httputil: panic")
+
+// HandlerOption is LimitHandler option function.
+type HandlerOption func(*handlerOptions)
+
+type handlerOptions struct {
+	status     int
+	retryAfter time.Duration
+	exempt     map[string]bool
+	failOpen   bool
+}
+
+// WithRejectStatus with the status code of the rejected requests,
+// default is 429 Too Many Requests.
+func WithRejectStatus(code int) HandlerOption {
+	return func(o *handlerOptions) {
+		o.status = code
+	}
+}
+
+// WithRetryAfter with the duration sent in the Retry-After header of
+// the rejected requests, zero omits the header.
+func WithRetryAfter(d time.Duration) HandlerOption {
+	return func(o *handlerOptions) {
+		o.retryAfter = d
+	}
+}
+
+// WithFailOpen with the requests served when the rate limiter fails with an
+// error other than ratelimiter.ErrLimitExceed, e.g. its store is down, they
+// get 503 Service Unavailable by default.
+func WithFailOpen(failOpen bool) HandlerOption {
+	return func(o *handlerOptions) {
+		o.failOpen = failOpen
+	}
+}
+
+// WithExemptPaths with the URL paths never rejected, e.g. health checks.
+func WithExemptPaths(paths ...string) HandlerOption {
+	return func(o *handlerOptions) {
+		for _, p := range paths {
+			o.exempt[p] = true
+		}
+	}
+}
+
+// LimitHandler returns a http.Handler rejecting the requests the rate
+// limiter does not allow, the other errors of the limiter are handled as
+// set by WithFailOpen. The outcome of the allowed requests is reported
+// to the limiter, 5xx responses and panics are reported as errors.
+func LimitHandler(l ratelimiter.RateLimiter, next http.Handler, opts ...HandlerOption) http.Handler {
+	opt := handlerOptions{
+		status:     http.StatusTooManyRequests,
+		retryAfter: time.Second,
+		exempt:     make(map[string]bool),
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	retryAfter := ""
+	if opt.retryAfter > 0 {
+		retryAfter = strconv.FormatInt(int64((opt.retryAfter+time.Second-1)/time.Second), 10)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if opt.exempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		done, err := l.Allow()
+		switch {
+		case err == nil:
+		case errors.Is(err, ratelimiter.ErrLimitExceed):
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			http.Error(w, http.StatusText(opt.status), opt.status)
+			return
+		case opt.failOpen:
+			next.ServeHTTP(w, r)
+			return
+		default:
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		panicked := true
+		defer func() {
+			var info ratelimiter.DoneInfo
+			if panicked {
+				info.Err = errPanic
+			} else if rec.status >= http.StatusInternalServerError {
+				info.Err = statusError(rec.status)
+			}
+			done(info)
+		}()
+		next.ServeHTTP(rec.wrap(), r)
+		panicked = false
+	})
+}
+
+func statusError(code int) error {
+	return fmt.Errorf("httputil: response status %d", code)
+}
+
+// statusRecorder records the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	r.wroteHeader = true
+	r.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return r.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+func (r *statusRecorder) Push(target string, opts *http.PushOptions) error {
+	return r.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// Unwrap returns the underlying http.ResponseWriter.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+type unwrapper interface {
+	Unwrap() http.ResponseWriter
+}
+
+// wrap returns the recorder implementing the http.Flusher, http.Hijacker
+// and http.Pusher interfaces implemented by the underlying writer.
+func (r *statusRecorder) wrap() http.ResponseWriter {
+	_, f := r.ResponseWriter.(http.Flusher)
+	_, h := r.ResponseWriter.(http.Hijacker)
+	_, p := r.ResponseWriter.(http.Pusher)
+	switch {
+	case f && h && p:
+		return struct {
+			http.ResponseWriter
+			unwrapper
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{r, r, r, r, r}
+	case f && h:
+		return struct {
+			http.ResponseWriter
+			unwrapper
+			http.Flusher
+			http.Hijacker
+		}{r, r, r, r}
+	case f && p:
+		return struct {
+			http.ResponseWriter
+			unwrapper
+			http.Flusher
+			http.Pusher
+		}{r, r, r, r}
+	case h && p:
+		return struct {
+			http.ResponseWriter
+			unwrapper
+			http.Hijacker
+			http.Pusher
+		}{r, r, r, r}
+	case f:
+		return struct {
+			http.ResponseWriter
+			unwrapper
+			http.Flusher
+		}{r, r, r}
+	case h:
+		return struct {
+			http.ResponseWriter
+			unwrapper
+			http.Hijacker
+		}{r, r, r}
+	case p:
+		return struct {
+			http.ResponseWriter
+			unwrapper
+			http.Pusher
+		}{r, r, r}
+	}
+	return struct {
+		http.ResponseWriter
+		unwrapper
+	}{r, r}
+}
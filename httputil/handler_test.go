@@ -0,0 +1,127 @@
+package httputil
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+	"github.com/stretchr/testify/assert"
+)
+
+type testLimiter struct {
+	err   error
+	infos []ratelimiter.DoneInfo
+}
+
+func (l *testLimiter) Allow() (ratelimiter.DoneFunc, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	return func(info ratelimiter.DoneInfo) {
+		l.infos = append(l.infos, info)
+	}, nil
+}
+
+func serve(h http.Handler, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestLimitHandler(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/error":
+			w.WriteHeader(http.StatusBadGateway)
+		case "/panic":
+			panic(http.ErrAbortHandler)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		l := &testLimiter{}
+		h := LimitHandler(l, next)
+		assert.Equal(t, http.StatusOK, serve(h, "/").Code)
+		assert.Equal(t, http.StatusBadGateway, serve(h, "/error").Code)
+		assert.Panics(t, func() { serve(h, "/panic") })
+		assert.Len(t, l.infos, 3)
+		assert.Nil(t, l.infos[0].Err)
+		assert.EqualError(t, l.infos[1].Err, "httputil: response status 502")
+		assert.Equal(t, errPanic, l.infos[2].Err)
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		l := &testLimiter{err: ratelimiter.ErrLimitExceed}
+		rec := serve(LimitHandler(l, next), "/")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+		rec = serve(LimitHandler(l, next, WithRejectStatus(http.StatusServiceUnavailable), WithRetryAfter(0)), "/")
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Empty(t, rec.Header().Get("Retry-After"))
+	})
+
+	t.Run("limiter failed", func(t *testing.T) {
+		l := &testLimiter{err: errors.New("store unavailable")}
+		rec := serve(LimitHandler(l, next), "/")
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Empty(t, rec.Header().Get("Retry-After"))
+
+		// the wrapped limit errors are still rejected.
+		l.err = fmt.Errorf("wrapped: %w", ratelimiter.ErrLimitExceed)
+		assert.Equal(t, http.StatusTooManyRequests, serve(LimitHandler(l, next, WithFailOpen(true)), "/").Code)
+		l.err = errors.New("store unavailable")
+		assert.Equal(t, http.StatusOK, serve(LimitHandler(l, next, WithFailOpen(true)), "/").Code)
+	})
+
+	t.Run("exempt", func(t *testing.T) {
+		l := &testLimiter{err: ratelimiter.ErrLimitExceed}
+		h := LimitHandler(l, next, WithExemptPaths("/healthz"))
+		assert.Equal(t, http.StatusOK, serve(h, "/healthz").Code)
+		assert.Equal(t, http.StatusTooManyRequests, serve(h, "/").Code)
+	})
+}
+
+type hijackWriter struct {
+	http.ResponseWriter
+	hijacked bool
+}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return nil, nil, nil
+}
+
+func TestLimitHandlerInterfaces(t *testing.T) {
+	var flusher, hijacker, pusher bool
+	h := LimitHandler(&testLimiter{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, flusher = w.(http.Flusher)
+		_, hijacker = w.(http.Hijacker)
+		_, pusher = w.(http.Pusher)
+		if hj, ok := w.(http.Hijacker); ok {
+			_, _, _ = hj.Hijack()
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}))
+
+	rec := serve(h, "/")
+	assert.True(t, flusher)
+	assert.False(t, hijacker)
+	assert.False(t, pusher)
+	assert.True(t, rec.Flushed)
+
+	w := &hijackWriter{ResponseWriter: struct{ http.ResponseWriter }{httptest.NewRecorder()}}
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.False(t, flusher)
+	assert.True(t, hijacker)
+	assert.True(t, w.hijacked)
+}
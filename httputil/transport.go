@@ -0,0 +1,241 @@
+package httputil
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/circuitbreaker"
+	"github.com/devexps/go-pkg/v2/circuitbreaker/cooh"
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+)
+
+var defaultClassifier = circuitbreaker.NewClassifier()
+
+// Breakers returns the circuit breaker of a key, *circuitbreaker.Group
+// implements it with lazily created breakers.
+type Breakers interface {
+	Get(key string) circuitbreaker.CircuitBreaker
+}
+
+// RejectedError is returned by Transport when a request is rejected by
+// the circuit breaker or the rate limiter.
+type RejectedError struct {
+	Key string
+	Err error
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("httputil: request to %s rejected: %v", e.Key, e.Err)
+}
+
+func (e *RejectedError) Unwrap() error {
+	return e.Err
+}
+
+// TransportOption is Transport option function.
+type TransportOption func(*transportOptions)
+
+type transportOptions struct {
+	key        func(*http.Request) string
+	breakers   Breakers
+	limiter    ratelimiter.RateLimiter
+	classifier func(*http.Response, error) circuitbreaker.Outcome
+	synthetic  bool
+	idle       time.Duration
+}
+
+// WithKeyFunc with the function returning the breaker key of a request,
+// default is the host of the request URL.
+func WithKeyFunc(f func(*http.Request) string) TransportOption {
+	return func(o *transportOptions) {
+		o.key = f
+	}
+}
+
+// WithBreakers with the breakers of the keys, default is a
+// circuitbreaker.Group of cooh breakers evicted once idle.
+func WithBreakers(b Breakers) TransportOption {
+	return func(o *transportOptions) {
+		o.breakers = b
+	}
+}
+
+// WithLimiter with the rate limiter every request goes through.
+func WithLimiter(l ratelimiter.RateLimiter) TransportOption {
+	return func(o *transportOptions) {
+		o.limiter = l
+	}
+}
+
+// WithResponseClassifier with the classifier of the responses,
+// default is ClassifyResponse.
+func WithResponseClassifier(f func(*http.Response, error) circuitbreaker.Outcome) TransportOption {
+	return func(o *transportOptions) {
+		o.classifier = f
+	}
+}
+
+// WithSyntheticResponse makes the rejected requests return a synthetic
+// 503 Service Unavailable response instead of a *RejectedError.
+func WithSyntheticResponse() TransportOption {
+	return func(o *transportOptions) {
+		o.synthetic = true
+	}
+}
+
+// WithIdleTimeout with the duration after which an unused breaker of the
+// default group is evicted, default is 10 minutes, zero disables the
+// eviction. The breakers set by WithBreakers are never evicted.
+func WithIdleTimeout(d time.Duration) TransportOption {
+	return func(o *transportOptions) {
+		o.idle = d
+	}
+}
+
+// ClassifyResponse classifies the transport errors, except the canceled
+// requests, and the 5xx and 429 responses as failures.
+func ClassifyResponse(resp *http.Response, err error) circuitbreaker.Outcome {
+	if err != nil {
+		return defaultClassifier(err)
+	}
+	if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+		return circuitbreaker.OutcomeFailure
+	}
+	return circuitbreaker.OutcomeSuccess
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// Transport is a http.RoundTripper protecting the requests with
+// a circuit breaker per key and an optional rate limiter.
+type Transport struct {
+	next http.RoundTripper
+	opts transportOptions
+
+	// group is the default group, evicted at most once per idle timeout.
+	group     *circuitbreaker.Group[cooh.Option]
+	lastEvict int64
+}
+
+// NewTransport returns a Transport sending the requests with next,
+// a nil next is http.DefaultTransport.
+func NewTransport(next http.RoundTripper, opts ...TransportOption) *Transport {
+	opt := transportOptions{
+		key: func(req *http.Request) string {
+			return req.URL.Host
+		},
+		classifier: ClassifyResponse,
+		idle:       10 * time.Minute,
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	t := &Transport{
+		next:      next,
+		lastEvict: time.Now().UnixNano(),
+	}
+	if opt.breakers == nil {
+		t.group = circuitbreaker.NewGroup(cooh.NewBreaker)
+		opt.breakers = t.group
+	}
+	if t.next == nil {
+		t.next = http.DefaultTransport
+	}
+	t.opts = opt
+	return t
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.evictIdle()
+	key := t.opts.key(req)
+	// the limiter goes first, a breaker admission is always marked.
+	var done ratelimiter.DoneFunc
+	if t.opts.limiter != nil {
+		var err error
+		if done, err = t.opts.limiter.Allow(); err != nil {
+			return t.reject(req, key, err)
+		}
+	}
+	cb := t.opts.breakers.Get(key)
+	if err := cb.Allow(); err != nil {
+		if done != nil {
+			done(ratelimiter.DoneInfo{Err: err})
+		}
+		return t.reject(req, key, err)
+	}
+
+	start := time.Now()
+	panicked := true
+	defer func() {
+		if !panicked {
+			return
+		}
+		cb.MarkFailed()
+		if done != nil {
+			done(ratelimiter.DoneInfo{Err: errPanic})
+		}
+	}()
+	resp, err := t.next.RoundTrip(req)
+	panicked = false
+
+	outcome := t.opts.classifier(resp, err)
+	switch outcome {
+	case circuitbreaker.OutcomeSuccess:
+		if lm, ok := cb.(circuitbreaker.LatencyMarker); ok {
+			lm.MarkSuccessWithLatency(time.Since(start))
+		} else {
+			cb.MarkSuccess()
+		}
+	case circuitbreaker.OutcomeFailure:
+		cb.MarkFailed()
+	case circuitbreaker.OutcomeIgnore:
+		if r, ok := cb.(circuitbreaker.Releaser); ok {
+			r.Release()
+		}
+	}
+	if done != nil {
+		info := ratelimiter.DoneInfo{Err: err}
+		if err == nil && outcome == circuitbreaker.OutcomeFailure {
+			info.Err = statusError(resp.StatusCode)
+		}
+		done(info)
+	}
+	return resp, err
+}
+
+// evictIdle evicts the idle breakers of the default group, at most once
+// per idle timeout.
+func (t *Transport) evictIdle() {
+	if t.group == nil || t.opts.idle <= 0 {
+		return
+	}
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&t.lastEvict)
+	if now-last < int64(t.opts.idle) || !atomic.CompareAndSwapInt64(&t.lastEvict, last, now) {
+		return
+	}
+	t.group.EvictIdle(t.opts.idle)
+}
+
+func (t *Transport) reject(req *http.Request, key string, err error) (*http.Response, error) {
+	// RoundTrip must always close the body.
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+	if !t.opts.synthetic {
+		return nil, &RejectedError{Key: key, Err: err}
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", http.StatusServiceUnavailable, http.StatusText(http.StatusServiceUnavailable)),
+		StatusCode: http.StatusServiceUnavailable,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
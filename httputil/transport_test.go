@@ -0,0 +1,143 @@
+package httputil
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/bulkhead"
+	"github.com/devexps/go-pkg/v2/circuitbreaker"
+	"github.com/devexps/go-pkg/v2/circuitbreaker/threestate"
+	"github.com/devexps/go-pkg/v2/clock/manual"
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStatusServer(status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+}
+
+func TestClassifyResponse(t *testing.T) {
+	assert.Equal(t, circuitbreaker.OutcomeSuccess, ClassifyResponse(&http.Response{StatusCode: 404}, nil))
+	assert.Equal(t, circuitbreaker.OutcomeFailure, ClassifyResponse(&http.Response{StatusCode: 429}, nil))
+	assert.Equal(t, circuitbreaker.OutcomeFailure, ClassifyResponse(&http.Response{StatusCode: 502}, nil))
+	assert.Equal(t, circuitbreaker.OutcomeFailure, ClassifyResponse(nil, errors.New("connection refused")))
+}
+
+func TestTransport(t *testing.T) {
+	failing := newStatusServer(http.StatusInternalServerError)
+	defer failing.Close()
+	healthy := newStatusServer(http.StatusOK)
+	defer healthy.Close()
+
+	breakers := circuitbreaker.NewGroup(threestate.NewBreaker, threestate.WithConsecutiveFailures(2))
+	client := &http.Client{Transport: NewTransport(nil, WithBreakers(breakers))}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(failing.URL)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		resp.Body.Close()
+	}
+
+	_, err := client.Get(failing.URL)
+	var rejected *RejectedError
+	assert.True(t, errors.As(err, &rejected))
+	assert.Equal(t, failing.Listener.Addr().String(), rejected.Key)
+	assert.True(t, errors.Is(err, circuitbreaker.ErrNotAllowed))
+
+	resp, err := client.Get(healthy.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	t.Run("synthetic response", func(t *testing.T) {
+		client := &http.Client{Transport: NewTransport(nil, WithBreakers(breakers), WithSyntheticResponse())}
+		resp, err := client.Get(failing.URL)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		resp.Body.Close()
+	})
+}
+
+func TestTransportWithLimiter(t *testing.T) {
+	srv := newStatusServer(http.StatusOK)
+	defer srv.Close()
+
+	limiter := bulkhead.New(bulkhead.WithMaxConcurrent(1))
+	client := &http.Client{Transport: NewTransport(nil, WithLimiter(limiter))}
+	resp, err := client.Get(srv.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, bulkhead.Stat{}, limiter.Stat())
+
+	done, _ := limiter.Allow()
+	defer done(ratelimiter.DoneInfo{})
+	_, err = client.Get(srv.URL)
+	assert.True(t, errors.Is(err, ratelimiter.ErrLimitExceed))
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestTransportLimiterFirst(t *testing.T) {
+	srv := newStatusServer(http.StatusOK)
+	defer srv.Close()
+
+	// a rejection of the limiter does not take the single half-open probe.
+	c := manual.New(time.Now())
+	cb := threestate.NewBreaker(threestate.WithConsecutiveFailures(1), threestate.WithMaxProbes(1), threestate.WithClock(c))
+	cb.MarkFailed()
+	c.Advance(time.Minute)
+	breakers := circuitbreaker.NewGroup(func(...string) circuitbreaker.CircuitBreaker { return cb })
+	limiter := bulkhead.New(bulkhead.WithMaxConcurrent(1))
+	client := &http.Client{Transport: NewTransport(nil, WithBreakers(breakers), WithLimiter(limiter))}
+	done, _ := limiter.Allow()
+	_, err := client.Get(srv.URL)
+	assert.True(t, errors.Is(err, ratelimiter.ErrLimitExceed))
+	done(ratelimiter.DoneInfo{})
+
+	resp, err := client.Get(srv.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, threestate.StateClosed, cb.(*threestate.Breaker).State())
+}
+
+func TestTransportPanic(t *testing.T) {
+	cb := threestate.NewBreaker(threestate.WithConsecutiveFailures(1))
+	breakers := circuitbreaker.NewGroup(func(...string) circuitbreaker.CircuitBreaker { return cb })
+	limiter := bulkhead.New(bulkhead.WithMaxConcurrent(1))
+	transport := NewTransport(roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		panic("boom")
+	}), WithBreakers(breakers), WithLimiter(limiter))
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+	assert.PanicsWithValue(t, "boom", func() {
+		_, _ = transport.RoundTrip(req)
+	})
+	assert.Equal(t, circuitbreaker.ErrNotAllowed, cb.Allow())
+	assert.Equal(t, bulkhead.Stat{}, limiter.Stat())
+}
+
+func TestTransportEvictIdle(t *testing.T) {
+	srv := newStatusServer(http.StatusOK)
+	defer srv.Close()
+
+	transport := NewTransport(nil, WithIdleTimeout(time.Millisecond))
+	client := &http.Client{Transport: transport}
+	resp, err := client.Get(srv.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Len(t, transport.group.Snapshot(), 1)
+
+	time.Sleep(5 * time.Millisecond)
+	transport.evictIdle()
+	assert.Len(t, transport.group.Snapshot(), 0)
+
+	assert.Nil(t, NewTransport(nil, WithBreakers(circuitbreaker.NewGroup(threestate.NewBreaker))).group)
+}
@@ -0,0 +1,100 @@
+package distributed
+
+import (
+	"context"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock"
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+	"github.com/devexps/go-pkg/v2/ratelimiter/internal/gcra"
+	"github.com/devexps/go-pkg/v2/ratelimiter/tokenbucket"
+)
+
+var _ ratelimiter.RateLimiter = (*Limiter)(nil)
+
+// Limiter is a cluster-wide rate limiter, it runs the generic cell rate
+// algorithm on the theoretical arrival time of its key in a shared Store.
+type Limiter struct {
+	store     Store
+	key       string
+	interval  int64
+	tolerance int64
+	opts      options
+}
+
+// New returns a distributed limiter of the key in the store with options.
+func New(store Store, key string, opts ...Option) *Limiter {
+	opt := options{
+		Rate:    100,
+		Burst:   100,
+		Timeout: 50 * time.Millisecond,
+		Retries: 3,
+		Clock:   clock.New(),
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	if opt.Retries < 1 {
+		opt.Retries = 1
+	}
+	if opt.Fallback == nil {
+		opt.Fallback = tokenbucket.New(
+			tokenbucket.WithRate(opt.Rate),
+			tokenbucket.WithBurst(opt.Burst),
+			tokenbucket.WithClock(opt.Clock),
+		)
+	}
+	interval, tolerance := gcra.Params(opt.Rate, opt.Burst)
+	return &Limiter{
+		store:     store,
+		key:       key,
+		interval:  interval,
+		tolerance: tolerance,
+		opts:      opt,
+	}
+}
+
+// Allow checks the quota of the cluster, the fallback limiter decides
+// when the store fails.
+func (l *Limiter) Allow() (ratelimiter.DoneFunc, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+	ok, err := l.allow(ctx)
+	if err != nil {
+		return l.opts.Fallback.Allow()
+	}
+	if !ok {
+		return nil, ratelimiter.ErrLimitExceed
+	}
+	return func(ratelimiter.DoneInfo) {}, nil
+}
+
+func (l *Limiter) allow(ctx context.Context) (bool, error) {
+	if t, ok := l.store.(Taker); ok {
+		return t.Take(ctx, l.key, l.opts.Clock.Now().UnixNano(), l.interval, l.tolerance)
+	}
+	for i := 0; i < l.opts.Retries; i++ {
+		prev, err := l.store.Get(ctx, l.key)
+		if err != nil {
+			return false, err
+		}
+		now := l.opts.Clock.Now().UnixNano()
+		tat := prev
+		if tat < now {
+			tat = now
+		}
+		next := gcra.Add(tat, l.interval)
+		if next-l.tolerance > now {
+			return false, nil
+		}
+		// the key is useless once the bucket is full again.
+		swapped, err := l.store.CompareAndSwap(ctx, l.key, prev, next, time.Duration(next-now))
+		if err != nil {
+			return false, err
+		}
+		if swapped {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,102 @@
+package distributed
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock/manual"
+	"github.com/devexps/go-pkg/v2/ratelimiter/internal/ratelimitertest"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingStore struct{}
+
+func (failingStore) Get(context.Context, string) (int64, error) {
+	return 0, errors.New("unreachable")
+}
+
+func (failingStore) CompareAndSwap(context.Context, string, int64, int64, time.Duration) (bool, error) {
+	return false, errors.New("unreachable")
+}
+
+func TestAllow(t *testing.T) {
+	c := manual.New(time.Unix(1000, 0))
+	store := NewMemoryStore(c)
+	// two instances share the quota of the key.
+	l0 := New(store, "key", WithRate(10), WithBurst(4), WithClock(c))
+	l1 := New(store, "key", WithRate(10), WithBurst(4), WithClock(c))
+	other := New(store, "other", WithRate(10), WithBurst(4), WithClock(c))
+	assert.Equal(t, 2, ratelimitertest.AllowN(l0, 2))
+	assert.Equal(t, 2, ratelimitertest.AllowN(l1, 3))
+	assert.Equal(t, 0, ratelimitertest.AllowN(l0, 1))
+	assert.Equal(t, 4, ratelimitertest.AllowN(other, 5))
+
+	c.Advance(100 * time.Millisecond)
+	assert.Equal(t, 1, ratelimitertest.AllowN(l1, 2))
+	c.Advance(time.Hour)
+	assert.Equal(t, 4, ratelimitertest.AllowN(l0, 5))
+}
+
+func TestAllowConcurrent(t *testing.T) {
+	c := manual.New(time.Unix(1000, 0))
+	store := NewMemoryStore(c)
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l := New(store, "key", WithRate(1), WithBurst(50), WithRetries(100), WithClock(c))
+			n := ratelimitertest.AllowN(l, 20)
+			mu.Lock()
+			allowed += n
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 50, allowed)
+}
+
+func TestFallback(t *testing.T) {
+	c := manual.New(time.Unix(1000, 0))
+	l := New(failingStore{}, "key", WithRate(1), WithBurst(2), WithClock(c))
+	assert.Equal(t, 2, ratelimitertest.AllowN(l, 3))
+
+	fallback := New(NewMemoryStore(c), "key", WithBurst(1), WithClock(c))
+	l = New(failingStore{}, "key", WithFallback(fallback))
+	assert.Equal(t, 1, ratelimitertest.AllowN(l, 2))
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	c := manual.New(time.Unix(1000, 0))
+	s := NewMemoryStore(c)
+	v, err := s.Get(ctx, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), v)
+
+	ok, _ := s.CompareAndSwap(ctx, "key", 1, 2, time.Second)
+	assert.False(t, ok)
+	ok, _ = s.CompareAndSwap(ctx, "key", 0, 2, time.Second)
+	assert.True(t, ok)
+	v, _ = s.Get(ctx, "key")
+	assert.Equal(t, int64(2), v)
+
+	c.Advance(time.Second)
+	v, _ = s.Get(ctx, "key")
+	assert.Equal(t, int64(0), v)
+}
+
+func TestZeroRate(t *testing.T) {
+	c := manual.New(time.Now())
+	l := New(NewMemoryStore(c), "key", WithRate(0), WithBurst(5), WithClock(c))
+	assert.Equal(t, 5, ratelimitertest.AllowN(l, 10))
+	c.Advance(24 * time.Hour)
+	assert.Equal(t, 0, ratelimitertest.AllowN(l, 1))
+}
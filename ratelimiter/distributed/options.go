@@ -0,0 +1,73 @@
+package distributed
+
+import (
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock"
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+)
+
+// Option function for distributed limiter
+type Option func(*options)
+
+// options of distributed limiter.
+type options struct {
+	// Rate defines the number of requests allowed per second in the cluster
+	Rate float64
+	// Burst defines the number of requests allowed at once in the cluster
+	Burst int
+	// Timeout defines the timeout of an Allow call to the store
+	Timeout time.Duration
+	// Retries defines the number of attempts when the compare-and-swap loses a race
+	Retries int
+	// Fallback is the limiter used when the store is unreachable
+	Fallback ratelimiter.RateLimiter
+	// Clock is the time source of the limiter
+	Clock clock.Clock
+}
+
+// WithRate with the number of requests allowed per second in the cluster.
+func WithRate(r float64) Option {
+	return func(o *options) {
+		o.Rate = r
+	}
+}
+
+// WithBurst with the number of requests allowed at once in the cluster.
+func WithBurst(b int) Option {
+	return func(o *options) {
+		o.Burst = b
+	}
+}
+
+// WithTimeout with the timeout of the store calls of an Allow call.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.Timeout = d
+	}
+}
+
+// WithRetries with the number of compare-and-swap attempts of an Allow call,
+// the request is rejected when all of them lose a race. It is unused with a
+// store implementing Taker.
+func WithRetries(n int) Option {
+	return func(o *options) {
+		o.Retries = n
+	}
+}
+
+// WithFallback with the limiter used when the store is unreachable, default
+// is a local token bucket with the rate and burst of the cluster.
+func WithFallback(l ratelimiter.RateLimiter) Option {
+	return func(o *options) {
+		o.Fallback = l
+	}
+}
+
+// WithClock with the time source of the limiter, default is the wall clock.
+// The clocks of the instances sharing a store must be synchronized.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.Clock = c
+	}
+}
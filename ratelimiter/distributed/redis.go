@@ -0,0 +1,373 @@
+package distributed
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// casScript sets the key only if it still holds the expected value, a missing
+// key is expected as "0".
+const casScript = `local v = redis.call('GET', KEYS[1])
+if v == ARGV[1] or (not v and ARGV[1] == '0') then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+	return 1
+end
+return 0`
+
+// takeScript runs the generic cell rate algorithm, ARGV holds now, the
+// interval and the tolerance in nanoseconds, and the ttl in milliseconds.
+// The Lua numbers are doubles, exact up to 2^53 only, so the nanoseconds
+// are split in two parts of base 1e9.
+const takeScript = `local function num(s)
+	local n = #s
+	if n <= 9 then
+		return {0, tonumber(s)}
+	end
+	return {tonumber(s:sub(1, n - 9)), tonumber(s:sub(n - 8))}
+end
+local function add(a, b)
+	local lo = a[2] + b[2]
+	if lo >= 1e9 then
+		return {a[1] + b[1] + 1, lo - 1e9}
+	end
+	return {a[1] + b[1], lo}
+end
+local function less(a, b)
+	return a[1] < b[1] or (a[1] == b[1] and a[2] < b[2])
+end
+local now = num(ARGV[1])
+local tat = now
+local v = redis.call('GET', KEYS[1])
+if v then
+	local t = num(v)
+	if less(now, t) then
+		tat = t
+	end
+end
+local nxt = add(tat, num(ARGV[2]))
+if less(add(now, num(ARGV[3])), nxt) then
+	return 0
+end
+local s = string.format('%d', nxt[2])
+if nxt[1] > 0 then
+	s = string.format('%d%09d', nxt[1], nxt[2])
+end
+redis.call('SET', KEYS[1], s, 'PX', ARGV[4])
+return 1`
+
+var (
+	casSHA  = scriptSHA(casScript)
+	takeSHA = scriptSHA(takeScript)
+)
+
+func scriptSHA(script string) string {
+	sum := sha1.Sum([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+var (
+	_ Store = (*RedisStore)(nil)
+	_ Taker = (*RedisStore)(nil)
+)
+
+// RedisError is an error reply of the server.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return "distributed: redis: " + string(e)
+}
+
+// RedisOption is RedisStore option function.
+type RedisOption func(*redisOptions)
+
+type redisOptions struct {
+	dialTimeout time.Duration
+	password    string
+	db          int
+	poolSize    int
+}
+
+// WithDialTimeout with the timeout of connecting to the server.
+func WithDialTimeout(d time.Duration) RedisOption {
+	return func(o *redisOptions) {
+		o.dialTimeout = d
+	}
+}
+
+// WithPassword with the password sent with AUTH on connect.
+func WithPassword(password string) RedisOption {
+	return func(o *redisOptions) {
+		o.password = password
+	}
+}
+
+// WithPoolSize with the number of idle connections kept, default is 8.
+func WithPoolSize(n int) RedisOption {
+	return func(o *redisOptions) {
+		o.poolSize = n
+	}
+}
+
+// WithDB with the database selected on connect.
+func WithDB(db int) RedisOption {
+	return func(o *redisOptions) {
+		o.db = db
+	}
+}
+
+// RedisStore is a Store speaking the Redis protocol over a pool of
+// connections, a command takes an idle connection or dials a new one, and
+// the connection is closed after an error.
+type RedisStore struct {
+	addr string
+	opts redisOptions
+
+	mu     sync.Mutex
+	idle   []*redisConn
+	closed bool
+}
+
+type redisConn struct {
+	net.Conn
+	rd *bufio.Reader
+}
+
+// NewRedisStore returns a RedisStore of the server at addr, it connects on
+// the first command.
+func NewRedisStore(addr string, opts ...RedisOption) *RedisStore {
+	opt := redisOptions{
+		dialTimeout: time.Second,
+		poolSize:    8,
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	return &RedisStore{
+		addr: addr,
+		opts: opt,
+	}
+}
+
+// Get implements Store.
+func (s *RedisStore) Get(ctx context.Context, key string) (int64, error) {
+	reply, err := s.do(ctx, "GET", key)
+	if err != nil || reply == nil {
+		return 0, err
+	}
+	str, ok := reply.(string)
+	if !ok {
+		return 0, fmt.Errorf("distributed: unexpected GET reply %T", reply)
+	}
+	return strconv.ParseInt(str, 10, 64)
+}
+
+// CompareAndSwap implements Store.
+func (s *RedisStore) CompareAndSwap(ctx context.Context, key string, old, new int64, ttl time.Duration) (bool, error) {
+	return s.eval(ctx, casScript, casSHA, key,
+		strconv.FormatInt(old, 10), strconv.FormatInt(new, 10), millis(ttl))
+}
+
+// Take implements Taker.
+func (s *RedisStore) Take(ctx context.Context, key string, now, interval, tolerance int64) (bool, error) {
+	return s.eval(ctx, takeScript, takeSHA, key,
+		strconv.FormatInt(now, 10), strconv.FormatInt(interval, 10), strconv.FormatInt(tolerance, 10),
+		millis(time.Duration(tolerance)))
+}
+
+// eval runs the script on the key by its digest, the script is sent only
+// when it is not in the script cache of the server yet.
+func (s *RedisStore) eval(ctx context.Context, script, sha, key string, args ...string) (bool, error) {
+	cmd := append([]string{"EVALSHA", sha, "1", key}, args...)
+	reply, err := s.do(ctx, cmd...)
+	var redisErr RedisError
+	if errors.As(err, &redisErr) && strings.HasPrefix(string(redisErr), "NOSCRIPT") {
+		cmd[0], cmd[1] = "EVAL", script
+		reply, err = s.do(ctx, cmd...)
+	}
+	if err != nil {
+		return false, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return false, fmt.Errorf("distributed: unexpected %s reply %T", cmd[0], reply)
+	}
+	return n == 1, nil
+}
+
+// millis returns the duration in milliseconds, rounded up to at least one.
+func millis(d time.Duration) string {
+	ms := (d + time.Millisecond - 1) / time.Millisecond
+	if ms < 1 {
+		ms = 1
+	}
+	return strconv.FormatInt(int64(ms), 10)
+}
+
+// Close closes the idle connections to the server, the connections in use
+// are closed once their command is done.
+func (s *RedisStore) Close() error {
+	s.mu.Lock()
+	idle := s.idle
+	s.idle, s.closed = nil, true
+	s.mu.Unlock()
+	var err error
+	for _, c := range idle {
+		if e := c.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (s *RedisStore) do(ctx context.Context, args ...string) (interface{}, error) {
+	c, err := s.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.roundTrip(ctx, args)
+	var redisErr RedisError
+	if err != nil && !errors.As(err, &redisErr) {
+		// the state of the connection is unknown.
+		_ = c.Close()
+		return reply, err
+	}
+	s.put(c)
+	return reply, err
+}
+
+// get takes an idle connection or dials a new one.
+func (s *RedisStore) get(ctx context.Context) (*redisConn, error) {
+	s.mu.Lock()
+	if n := len(s.idle); n > 0 {
+		c := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+		return c, nil
+	}
+	s.mu.Unlock()
+	return s.dial(ctx)
+}
+
+// put keeps the connection for the next commands, unless the pool is full
+// or closed.
+func (s *RedisStore) put(c *redisConn) {
+	s.mu.Lock()
+	if !s.closed && len(s.idle) < s.opts.poolSize {
+		s.idle = append(s.idle, c)
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+	_ = c.Close()
+}
+
+func (s *RedisStore) dial(ctx context.Context) (*redisConn, error) {
+	d := net.Dialer{Timeout: s.opts.dialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: conn, rd: bufio.NewReader(conn)}
+	var setup [][]string
+	if s.opts.password != "" {
+		setup = append(setup, []string{"AUTH", s.opts.password})
+	}
+	if s.opts.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.opts.db)})
+	}
+	for _, args := range setup {
+		if _, err = c.roundTrip(ctx, args); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *redisConn) roundTrip(ctx context.Context, args []string) (interface{}, error) {
+	// no deadline is the zero time, which clears the previous one.
+	deadline, _ := ctx.Deadline()
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	if _, err := c.Write(buf); err != nil {
+		return nil, err
+	}
+	return readReply(c.rd)
+}
+
+// readReply reads a reply of the Redis protocol, the simple and bulk strings
+// are returned as string, the integers as int64, the arrays as []interface{}
+// and the null replies as nil.
+func readReply(rd *bufio.Reader) (interface{}, error) {
+	line, err := readLine(rd)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("distributed: empty redis reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, RedisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err = io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		array := make([]interface{}, n)
+		for i := range array {
+			if array[i], err = readReply(rd); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	}
+	return nil, fmt.Errorf("distributed: invalid redis reply %q", line)
+}
+
+func readLine(rd *bufio.Reader) (string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("distributed: invalid redis line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,154 @@
+package distributed
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/devexps/go-pkg/v2/ratelimiter/internal/ratelimitertest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	m := miniredis.RunT(t)
+	s := NewRedisStore(m.Addr())
+	defer s.Close()
+
+	v, err := s.Get(ctx, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), v)
+	ok, err := s.CompareAndSwap(ctx, "key", 1, 2, time.Second)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = s.CompareAndSwap(ctx, "key", 0, 1700000000000000000, 1500*time.Microsecond)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	// the ttl is rounded up to milliseconds.
+	assert.Equal(t, 2*time.Millisecond, m.TTL("key"))
+	v, err = s.Get(ctx, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1700000000000000000), v)
+	assert.Equal(t, 1, m.TotalConnectionCount())
+}
+
+func TestRedisStoreTake(t *testing.T) {
+	ctx := context.Background()
+	m := miniredis.RunT(t)
+	s := NewRedisStore(m.Addr())
+	defer s.Close()
+
+	// the nanoseconds carry over the lower part of the split numbers.
+	now := int64(1700000000999999999)
+	ok, err := s.Take(ctx, "key", now, 2, 3)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	tat, err := m.Get("key")
+	assert.Nil(t, err)
+	assert.Equal(t, "1700000001000000001", tat)
+	assert.Equal(t, time.Millisecond, m.TTL("key"))
+
+	// the theoretical arrival time would be past now plus the tolerance.
+	ok, err = s.Take(ctx, "key", now, 2, 3)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = s.Take(ctx, "key", now+1, 2, 3)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	tat, _ = m.Get("key")
+	assert.Equal(t, "1700000001000000003", tat)
+
+	// a key in the past starts from now, small numbers are not split.
+	ok, err = s.Take(ctx, "small", 5, int64(time.Second), int64(time.Second))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	tat, _ = m.Get("small")
+	assert.Equal(t, "1000000005", tat)
+	assert.Equal(t, time.Second, m.TTL("small"))
+}
+
+func TestRedisStoreAuth(t *testing.T) {
+	ctx := context.Background()
+	m := miniredis.RunT(t)
+	m.RequireAuth("secret")
+	_, err := NewRedisStore(m.Addr(), WithPassword("wrong")).Get(ctx, "key")
+	var redisErr RedisError
+	assert.True(t, errors.As(err, &redisErr))
+	assert.True(t, strings.HasPrefix(string(redisErr), "WRONGPASS"), err)
+
+	s := NewRedisStore(m.Addr(), WithPassword("secret"))
+	defer s.Close()
+	_, err = s.Get(ctx, "key")
+	assert.Nil(t, err)
+}
+
+func TestRedisStoreReconnect(t *testing.T) {
+	ctx := context.Background()
+	m := miniredis.RunT(t)
+	s := NewRedisStore(m.Addr())
+	_, err := s.Get(ctx, "key")
+	assert.Nil(t, err)
+
+	// the broken connection is dropped, the next command dials again.
+	_ = s.idle[0].Close()
+	_, err = s.Get(ctx, "key")
+	assert.NotNil(t, err)
+	_, err = s.Get(ctx, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, m.TotalConnectionCount())
+	assert.Nil(t, s.Close())
+}
+
+func TestRedisStorePool(t *testing.T) {
+	ctx := context.Background()
+	m := miniredis.RunT(t)
+	s := NewRedisStore(m.Addr(), WithPoolSize(1))
+	c1, err := s.get(ctx)
+	assert.Nil(t, err)
+	c2, err := s.get(ctx)
+	assert.Nil(t, err)
+	// the connections beyond the pool size are closed.
+	s.put(c1)
+	s.put(c2)
+	assert.Equal(t, []*redisConn{c1}, s.idle)
+	_, err = s.Get(ctx, "key")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, m.TotalConnectionCount())
+
+	assert.Nil(t, s.Close())
+	assert.Empty(t, s.idle)
+}
+
+func TestRedisLimiter(t *testing.T) {
+	m := miniredis.RunT(t)
+	s := NewRedisStore(m.Addr())
+	defer s.Close()
+	l := New(s, "key", WithRate(1), WithBurst(3))
+	assert.Equal(t, 3, ratelimitertest.AllowN(l, 5))
+	v, err := m.Get("key")
+	assert.Nil(t, err)
+	tat, err := strconv.ParseInt(v, 10, 64)
+	assert.Nil(t, err)
+	assert.Greater(t, tat, time.Now().UnixNano())
+	assert.Equal(t, 3*time.Second, m.TTL("key"))
+	// a single EVALSHA per Allow, the script is sent once with EVAL, and
+	// the calls of the script, a GET per run and a SET per allowed run.
+	assert.Equal(t, 5+1+5+3, m.CommandCount())
+}
+
+func TestRedisUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	l := New(NewRedisStore(addr), "key", WithRate(1), WithBurst(2))
+	// the local fallback limits the requests.
+	assert.Equal(t, 2, ratelimitertest.AllowN(l, 3))
+}
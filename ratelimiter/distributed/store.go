@@ -0,0 +1,86 @@
+package distributed
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock"
+)
+
+// Store is the shared state of the limiters of a cluster. The values are
+// the theoretical arrival times of the keys, a missing or expired key has
+// the value zero.
+type Store interface {
+	// Get returns the value of the key.
+	Get(ctx context.Context, key string) (int64, error)
+	// CompareAndSwap sets the value of the key to new, expiring after ttl,
+	// if its value is still old, and reports whether it was set.
+	CompareAndSwap(ctx context.Context, key string, old, new int64, ttl time.Duration) (bool, error)
+}
+
+// Taker is implemented by the stores able to run the generic cell rate
+// algorithm in a single call, the Limiter uses it instead of Get and
+// CompareAndSwap.
+type Taker interface {
+	// Take moves the theoretical arrival time of the key by interval from
+	// the later of its value and now, if the result is at most tolerance
+	// after now, and reports whether it was moved. The times and durations
+	// are in nanoseconds, the key can expire once the bucket is full again.
+	Take(ctx context.Context, key string, now, interval, tolerance int64) (bool, error)
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// MemoryStore is a Store within the process, for tests and single instances.
+type MemoryStore struct {
+	mu    sync.Mutex
+	items map[string]memoryItem
+	clock clock.Clock
+}
+
+type memoryItem struct {
+	value  int64
+	expire time.Time
+}
+
+// NewMemoryStore returns a MemoryStore, a nil clock is the wall clock.
+func NewMemoryStore(c clock.Clock) *MemoryStore {
+	if c == nil {
+		c = clock.New()
+	}
+	return &MemoryStore{
+		items: make(map[string]memoryItem),
+		clock: c,
+	}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(_ context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(key), nil
+}
+
+// CompareAndSwap implements Store.
+func (s *MemoryStore) CompareAndSwap(_ context.Context, key string, old, new int64, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.get(key) != old {
+		return false, nil
+	}
+	s.items[key] = memoryItem{value: new, expire: s.clock.Now().Add(ttl)}
+	return true, nil
+}
+
+func (s *MemoryStore) get(key string) int64 {
+	item, ok := s.items[key]
+	if !ok {
+		return 0
+	}
+	if !s.clock.Now().Before(item.expire) {
+		delete(s.items, key)
+		return 0
+	}
+	return item.value
+}
@@ -0,0 +1,104 @@
+package gradient
+
+import (
+	"math"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+	"github.com/devexps/go-pkg/v2/ratelimiter/internal/adaptive"
+)
+
+var _ ratelimiter.RateLimiter = (*Limiter)(nil)
+
+// Limiter is an adaptive concurrency limiter comparing the RTT of every
+// request to a long-term average RTT, the limit grows while the RTT stays
+// close to the average and shrinks as it rises, i.e. as requests queue up.
+//
+//	gradient = max(0.5, min(1, tolerance * longRTT / rtt))
+//	limit = limit * gradient + sqrt(limit)
+//
+// A failure multiplies the limit by the backoff ratio instead.
+type Limiter struct {
+	limiter *adaptive.Limiter
+
+	// longRTT is the average RTT over the long window, in nanoseconds,
+	// guarded by the lock of the limiter.
+	longRTT float64
+
+	opts options
+}
+
+// Stat contains the metrics snapshot of the gradient limiter.
+type Stat struct {
+	Limit    int64
+	InFlight int64
+	// LongRTT is the long-term average RTT.
+	LongRTT time.Duration
+}
+
+// New returns a gradient limiter with options.
+func New(opts ...Option) *Limiter {
+	opt := options{
+		Options:    adaptive.DefaultOptions(),
+		Tolerance:  1.5,
+		LongWindow: 600,
+		Backoff:    0.9,
+	}
+	opt.Smoothing = 0.2
+	for _, o := range opts {
+		o(&opt)
+	}
+	if opt.LongWindow < 1 {
+		opt.LongWindow = 1
+	}
+	l := &Limiter{opts: opt}
+	l.limiter = adaptive.New(opt.Options, l.update)
+	return l
+}
+
+// Allow implements ratelimiter.RateLimiter, the RTT reported to the
+// DoneFunc feeds the long-term average and the gradient.
+func (l *Limiter) Allow() (ratelimiter.DoneFunc, error) {
+	return l.limiter.Allow()
+}
+
+// Stat takes a snapshot of the gradient limiter.
+func (l *Limiter) Stat() Stat {
+	var longRTT float64
+	stat := l.limiter.Stat(func() {
+		longRTT = l.longRTT
+	})
+	return Stat{
+		Limit:    stat.Limit,
+		InFlight: stat.InFlight,
+		LongRTT:  time.Duration(longRTT),
+	}
+}
+
+// update moves the long-term RTT toward the RTT of the sample, and the
+// limit by the gradient between them.
+func (l *Limiter) update(limit float64, s adaptive.Sample) float64 {
+	if s.Failed {
+		return limit * l.opts.Backoff
+	}
+	if s.RTT <= 0 {
+		return limit
+	}
+	short := float64(s.RTT)
+	if l.longRTT == 0 {
+		l.longRTT = short
+	} else {
+		l.longRTT += (short - l.longRTT) / float64(l.opts.LongWindow)
+	}
+	// the long-term RTT recovers fast once a surge of latency is over.
+	if l.longRTT/short > 2 {
+		l.longRTT *= 0.95
+	}
+	// far below the limit the RTT does not depend on it, the gradient
+	// would only grow the limit without bound.
+	if float64(s.InFlight) < limit/2 {
+		return limit
+	}
+	gradient := math.Max(0.5, math.Min(1, l.opts.Tolerance*l.longRTT/short))
+	return l.limiter.Smooth(limit, limit*gradient+math.Sqrt(limit))
+}
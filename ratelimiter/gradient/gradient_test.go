@@ -0,0 +1,67 @@
+package gradient
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock/manual"
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+	"github.com/devexps/go-pkg/v2/ratelimiter/internal/ratelimitertest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSteadyRTT(t *testing.T) {
+	c := manual.New(time.Unix(1000, 0))
+	l := New(WithClock(c), WithInitialLimit(10))
+	for i := 0; i < 10; i++ {
+		ratelimitertest.Round(l, c, 10*time.Millisecond, nil)
+	}
+	stat := l.Stat()
+	assert.Greater(t, stat.Limit, int64(30))
+	assert.Equal(t, 10*time.Millisecond, stat.LongRTT)
+	assert.Equal(t, int64(0), stat.InFlight)
+}
+
+func TestRisingRTT(t *testing.T) {
+	c := manual.New(time.Unix(1000, 0))
+	l := New(WithClock(c), WithInitialLimit(100))
+	ratelimitertest.Round(l, c, 10*time.Millisecond, nil)
+	before := l.Stat().Limit
+	for i := 0; i < 10; i++ {
+		ratelimitertest.Round(l, c, 100*time.Millisecond, nil)
+	}
+	assert.Less(t, l.Stat().Limit, before/2)
+}
+
+func TestFailures(t *testing.T) {
+	c := manual.New(time.Unix(1000, 0))
+	l := New(WithClock(c), WithInitialLimit(100), WithMinLimit(5))
+	errTest := errors.New("unavailable")
+	// the failures of the requests in flight together back off once.
+	assert.Equal(t, 100, ratelimitertest.Round(l, c, 10*time.Millisecond, errTest))
+	assert.Equal(t, int64(90), l.Stat().Limit)
+	ratelimitertest.Round(l, c, 10*time.Millisecond, errTest)
+	assert.Equal(t, int64(81), l.Stat().Limit)
+
+	// a request allowed before the last backoff does not back off again.
+	done, err := l.Allow()
+	assert.Nil(t, err)
+	ratelimitertest.Round(l, c, 10*time.Millisecond, errTest)
+	assert.Equal(t, int64(72), l.Stat().Limit)
+	done(ratelimiter.DoneInfo{Err: errTest})
+	assert.Equal(t, int64(72), l.Stat().Limit)
+}
+
+func TestAppLimited(t *testing.T) {
+	c := manual.New(time.Unix(1000, 0))
+	l := New(WithClock(c), WithInitialLimit(100))
+	// a single request in flight says nothing about the limit.
+	for i := 0; i < 10; i++ {
+		done, err := l.Allow()
+		assert.Nil(t, err)
+		c.Advance(100 * time.Millisecond)
+		done(ratelimiter.DoneInfo{})
+	}
+	assert.Equal(t, int64(100), l.Stat().Limit)
+}
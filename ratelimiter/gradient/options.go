@@ -0,0 +1,78 @@
+package gradient
+
+import (
+	"github.com/devexps/go-pkg/v2/clock"
+	"github.com/devexps/go-pkg/v2/ratelimiter/internal/adaptive"
+)
+
+// Option function for gradient limiter
+type Option func(*options)
+
+// options of gradient limiter.
+type options struct {
+	adaptive.Options
+	// Tolerance defines the ratio of the long-term RTT to the current RTT tolerated before the limit decreases
+	Tolerance float64
+	// LongWindow defines the number of samples of the long-term RTT average
+	LongWindow int
+	// Backoff defines the ratio the limit is multiplied by on errors, once per window of requests in flight
+	Backoff float64
+}
+
+// WithInitialLimit with the concurrency limit before any sample.
+func WithInitialLimit(n int64) Option {
+	return func(o *options) {
+		o.InitialLimit = n
+	}
+}
+
+// WithMinLimit with the lowest concurrency limit.
+func WithMinLimit(n int64) Option {
+	return func(o *options) {
+		o.MinLimit = n
+	}
+}
+
+// WithMaxLimit with the highest concurrency limit.
+func WithMaxLimit(n int64) Option {
+	return func(o *options) {
+		o.MaxLimit = n
+	}
+}
+
+// WithSmoothing with the weight of a new limit against the current one, in (0, 1].
+func WithSmoothing(s float64) Option {
+	return func(o *options) {
+		o.Smoothing = s
+	}
+}
+
+// WithTolerance with the ratio of the long-term RTT to the current RTT
+// tolerated before the limit decreases.
+func WithTolerance(t float64) Option {
+	return func(o *options) {
+		o.Tolerance = t
+	}
+}
+
+// WithLongWindow with the number of samples of the long-term RTT average.
+func WithLongWindow(n int) Option {
+	return func(o *options) {
+		o.LongWindow = n
+	}
+}
+
+// WithBackoff with the ratio the limit is multiplied by when a request fails,
+// the failures of the requests allowed before the last backoff are ignored.
+func WithBackoff(r float64) Option {
+	return func(o *options) {
+		o.Backoff = r
+	}
+}
+
+// WithClock with the time source of the limiter, default is the wall clock.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.Clock = c
+	}
+}
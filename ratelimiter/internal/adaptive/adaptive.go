@@ -0,0 +1,153 @@
+// Package adaptive is the concurrency limit shared by the adaptive
+// limiters, which only differ by the way they update the limit.
+package adaptive
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock"
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+)
+
+var _ ratelimiter.RateLimiter = (*Limiter)(nil)
+
+// Options of the concurrency limit, embedded in the options of the limiters.
+type Options struct {
+	// InitialLimit defines the concurrency limit before any sample
+	InitialLimit int64
+	// MinLimit defines the lowest concurrency limit
+	MinLimit int64
+	// MaxLimit defines the highest concurrency limit
+	MaxLimit int64
+	// Smoothing defines the weight of a new limit, in (0, 1]
+	Smoothing float64
+	// Clock is the time source of the limiter
+	Clock clock.Clock
+}
+
+// DefaultOptions returns the default options, without smoothing.
+func DefaultOptions() Options {
+	return Options{
+		InitialLimit: 20,
+		MinLimit:     1,
+		MaxLimit:     1000,
+		Smoothing:    1,
+		Clock:        clock.New(),
+	}
+}
+
+// Sample is the outcome of a request.
+type Sample struct {
+	// Start is the time the request was allowed.
+	Start time.Time
+	RTT   time.Duration
+	// InFlight is the number of requests in flight with it.
+	InFlight int64
+	Failed   bool
+}
+
+// UpdateFunc returns the new limit from the current one and the sample of
+// a request, it is called under the lock of the Limiter. The failures of
+// the requests in flight together are a single failed sample, the ones of
+// the requests allowed before the last failed sample finished are dropped.
+type UpdateFunc func(limit float64, s Sample) float64
+
+// Stat contains the limit and the requests in flight.
+type Stat struct {
+	Limit    int64
+	InFlight int64
+}
+
+// Limiter allows the requests while the requests in flight are under the
+// limit, the samples of the requests update the limit.
+type Limiter struct {
+	inFlight int64
+	// limit is the current limit truncated, read without the lock.
+	limit int64
+
+	mu     sync.Mutex
+	value  float64
+	update UpdateFunc
+	// failedAt is the end of the last failed sample.
+	failedAt time.Time
+
+	opts Options
+}
+
+// New returns a Limiter with the options, the update function is the
+// algorithm of the limiter.
+func New(opts Options, update UpdateFunc) *Limiter {
+	if opts.MinLimit < 1 {
+		opts.MinLimit = 1
+	}
+	if opts.Smoothing <= 0 || opts.Smoothing > 1 {
+		opts.Smoothing = 1
+	}
+	l := &Limiter{update: update, opts: opts}
+	l.set(float64(opts.InitialLimit))
+	return l
+}
+
+// Allow takes a slot if the requests in flight are under the limit, the
+// RTT and the error reported to the DoneFunc update the limit.
+func (l *Limiter) Allow() (ratelimiter.DoneFunc, error) {
+	for {
+		inFlight := atomic.LoadInt64(&l.inFlight)
+		if inFlight >= atomic.LoadInt64(&l.limit) {
+			return nil, ratelimiter.ErrLimitExceed
+		}
+		if atomic.CompareAndSwapInt64(&l.inFlight, inFlight, inFlight+1) {
+			break
+		}
+	}
+	start := l.opts.Clock.Now()
+	var once int32
+	return func(info ratelimiter.DoneInfo) {
+		if !atomic.CompareAndSwapInt32(&once, 0, 1) {
+			return
+		}
+		s := Sample{
+			Start:    start,
+			RTT:      l.opts.Clock.Since(start),
+			InFlight: atomic.AddInt64(&l.inFlight, -1) + 1,
+			Failed:   info.Err != nil,
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if s.Failed {
+			if s.Start.Before(l.failedAt) {
+				return
+			}
+			l.failedAt = s.Start.Add(s.RTT)
+		}
+		l.set(l.update(l.value, s))
+	}, nil
+}
+
+// Stat takes a snapshot of the limit, f reads the state of the algorithm
+// under the lock if not nil.
+func (l *Limiter) Stat(f func()) Stat {
+	if f != nil {
+		l.mu.Lock()
+		f()
+		l.mu.Unlock()
+	}
+	return Stat{
+		Limit:    atomic.LoadInt64(&l.limit),
+		InFlight: atomic.LoadInt64(&l.inFlight),
+	}
+}
+
+// Smooth returns the limit weighted by the smoothing against the current one.
+func (l *Limiter) Smooth(current, limit float64) float64 {
+	return current*(1-l.opts.Smoothing) + limit*l.opts.Smoothing
+}
+
+func (l *Limiter) set(limit float64) {
+	limit = math.Max(float64(l.opts.MinLimit), math.Min(float64(l.opts.MaxLimit), limit))
+	l.value = limit
+	atomic.StoreInt64(&l.limit, int64(limit))
+}
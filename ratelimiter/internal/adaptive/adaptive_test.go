@@ -0,0 +1,64 @@
+package adaptive
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock/manual"
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllow(t *testing.T) {
+	c := manual.New(time.Unix(1000, 0))
+	opts := DefaultOptions()
+	opts.InitialLimit, opts.Clock = 2, c
+	var samples []Sample
+	l := New(opts, func(limit float64, s Sample) float64 {
+		samples = append(samples, s)
+		return limit + 1
+	})
+	done, err := l.Allow()
+	assert.Nil(t, err)
+	_, err = l.Allow()
+	assert.Nil(t, err)
+	_, err = l.Allow()
+	assert.Equal(t, ratelimiter.ErrLimitExceed, err)
+	assert.Equal(t, Stat{Limit: 2, InFlight: 2}, l.Stat(nil))
+
+	c.Advance(time.Second)
+	errTest := errors.New("test")
+	done(ratelimiter.DoneInfo{Err: errTest})
+	// a slot is freed once, the sample updates the limit.
+	done(ratelimiter.DoneInfo{})
+	assert.Equal(t, []Sample{{Start: time.Unix(1000, 0), RTT: time.Second, InFlight: 2, Failed: true}}, samples)
+	assert.Equal(t, Stat{Limit: 3, InFlight: 1}, l.Stat(nil))
+}
+
+func TestLimitBounds(t *testing.T) {
+	opts := DefaultOptions()
+	opts.MinLimit, opts.MaxLimit, opts.Smoothing = 0, 4, 0.5
+	var next float64
+	l := New(opts, func(float64, Sample) float64 {
+		return next
+	})
+	assert.Equal(t, int64(4), l.Stat(nil).Limit)
+	// the smoothing is in (0, 1].
+	assert.Equal(t, 3.0, l.Smooth(2, 4))
+
+	for _, tt := range []struct {
+		next  float64
+		limit int64
+	}{
+		{next: 100, limit: 4},
+		{next: 2.5, limit: 2},
+		{next: -1, limit: 1},
+	} {
+		next = tt.next
+		done, err := l.Allow()
+		assert.Nil(t, err)
+		done(ratelimiter.DoneInfo{})
+		assert.Equal(t, tt.limit, l.Stat(nil).Limit)
+	}
+}
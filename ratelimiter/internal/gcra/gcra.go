@@ -0,0 +1,38 @@
+// Package gcra computes the parameters of the generic cell rate algorithm
+// shared by the token bucket limiters.
+package gcra
+
+import (
+	"math"
+	"time"
+)
+
+// MaxTolerance is the upper bound of the duration of a full bucket, about
+// 73 years, so that a theoretical arrival time never overflows.
+const MaxTolerance = math.MaxInt64 / 4
+
+// Params returns the emission interval and the tolerance, the duration of
+// a full bucket, in nanoseconds of rate tokens per second and a burst. The
+// tolerance is capped at MaxTolerance, so a zero rate refills the bucket
+// once in MaxTolerance.
+func Params(rate float64, burst int) (interval, tolerance int64) {
+	if burst < 1 {
+		burst = 1
+	}
+	interval = MaxTolerance / int64(burst)
+	if rate > 0 && float64(time.Second)/rate < float64(interval) {
+		interval = int64(float64(time.Second) / rate)
+	}
+	if interval < 1 {
+		interval = 1
+	}
+	return interval, Add(0, interval*int64(burst))
+}
+
+// Add returns a + b saturated at math.MaxInt64, b is not negative.
+func Add(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
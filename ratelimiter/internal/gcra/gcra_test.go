@@ -0,0 +1,32 @@
+package gcra
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParams(t *testing.T) {
+	interval, tolerance := Params(10, 5)
+	assert.Equal(t, int64(100*time.Millisecond), interval)
+	assert.Equal(t, int64(500*time.Millisecond), tolerance)
+
+	interval, tolerance = Params(0, 5)
+	assert.Equal(t, int64(MaxTolerance/5), interval)
+	assert.LessOrEqual(t, tolerance, int64(MaxTolerance))
+
+	interval, tolerance = Params(1e-12, 1<<30)
+	assert.Equal(t, int64(MaxTolerance/(1<<30)), interval)
+	assert.LessOrEqual(t, tolerance, int64(MaxTolerance))
+
+	interval, tolerance = Params(1e12, 0)
+	assert.Equal(t, int64(1), interval)
+	assert.Equal(t, int64(1), tolerance)
+}
+
+func TestAdd(t *testing.T) {
+	assert.Equal(t, int64(3), Add(1, 2))
+	assert.Equal(t, int64(math.MaxInt64), Add(math.MaxInt64-1, 2))
+}
@@ -0,0 +1,38 @@
+// Package ratelimitertest provides helpers for testing the rate limiters.
+package ratelimitertest
+
+import (
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock/manual"
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+)
+
+// AllowN calls Allow n times and returns the number of allowed calls, the
+// allowed calls are never done.
+func AllowN(l ratelimiter.RateLimiter, n int) (allowed int) {
+	for i := 0; i < n; i++ {
+		if _, err := l.Allow(); err == nil {
+			allowed++
+		}
+	}
+	return
+}
+
+// Round takes all the slots of the limiter, advances the clock by rtt, then
+// finishes the allowed calls with err, and returns their number.
+func Round(l ratelimiter.RateLimiter, c *manual.Clock, rtt time.Duration, err error) int {
+	var dones []ratelimiter.DoneFunc
+	for {
+		done, e := l.Allow()
+		if e != nil {
+			break
+		}
+		dones = append(dones, done)
+	}
+	c.Advance(rtt)
+	for _, done := range dones {
+		done(ratelimiter.DoneInfo{Err: err})
+	}
+	return len(dones)
+}
@@ -0,0 +1,182 @@
+package ratelimiter
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock"
+)
+
+// KeyedOption is Keyed option function.
+type KeyedOption func(*keyedOptions)
+
+type keyedOptions struct {
+	shards  int
+	maxKeys int
+	ttl     time.Duration
+	clock   clock.Clock
+}
+
+// WithShards with the number of independently locked shards the keys are
+// spread over.
+func WithShards(n int) KeyedOption {
+	return func(o *keyedOptions) {
+		o.shards = n
+	}
+}
+
+// WithMaxKeys with the maximum number of tracked keys, zero means no limit.
+// The limit is split over the shards, whose number is lowered to the limit
+// if needed, and the least recently used keys of a full shard are evicted.
+func WithMaxKeys(n int) KeyedOption {
+	return func(o *keyedOptions) {
+		o.maxKeys = n
+	}
+}
+
+// WithTTL with the duration after which an unused key is evicted,
+// zero means the keys never expire.
+func WithTTL(d time.Duration) KeyedOption {
+	return func(o *keyedOptions) {
+		o.ttl = d
+	}
+}
+
+// WithClock with the time source of the expiration, default is the wall clock.
+func WithClock(c clock.Clock) KeyedOption {
+	return func(o *keyedOptions) {
+		o.clock = c
+	}
+}
+
+// Keyed is a rate limiter per key, e.g. per tenant or per client IP.
+// The limiters are lazily created by a factory and evicted when they expire
+// or when the number of keys exceeds the limit, an evicted key starts over
+// with a new limiter.
+type Keyed struct {
+	factory func(key string) RateLimiter
+	shards  []*shard
+	ttl     time.Duration
+	clock   clock.Clock
+}
+
+type shard struct {
+	mu      sync.Mutex
+	items   map[string]*list.Element
+	lru     *list.List
+	maxKeys int
+}
+
+type keyedEntry struct {
+	key      string
+	limiter  RateLimiter
+	lastUsed time.Time
+}
+
+// NewKeyed returns a Keyed limiter creating the limiter of a key with
+// the factory, e.g.
+//
+//	k := ratelimiter.NewKeyed(func(string) ratelimiter.RateLimiter {
+//		return tokenbucket.New(tokenbucket.WithRate(10))
+//	}, ratelimiter.WithTTL(10*time.Minute))
+func NewKeyed(factory func(key string) RateLimiter, opts ...KeyedOption) *Keyed {
+	if factory == nil {
+		panic("ratelimiter: can't assign a nil to the factory function")
+	}
+	opt := keyedOptions{
+		shards:  32,
+		maxKeys: 1 << 16,
+		clock:   clock.New(),
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	if opt.shards < 1 {
+		opt.shards = 1
+	}
+	if opt.maxKeys > 0 && opt.shards > opt.maxKeys {
+		opt.shards = opt.maxKeys
+	}
+	k := &Keyed{
+		factory: factory,
+		shards:  make([]*shard, opt.shards),
+		ttl:     opt.ttl,
+		clock:   opt.clock,
+	}
+	for i := range k.shards {
+		maxKeys := 0
+		if opt.maxKeys > 0 {
+			// the limits of the shards add up to the limit.
+			maxKeys = opt.maxKeys / opt.shards
+			if i < opt.maxKeys%opt.shards {
+				maxKeys++
+			}
+		}
+		k.shards[i] = &shard{
+			items:   make(map[string]*list.Element),
+			lru:     list.New(),
+			maxKeys: maxKeys,
+		}
+	}
+	return k
+}
+
+// Allow checks the limiter of the key.
+func (k *Keyed) Allow(key string) (DoneFunc, error) {
+	return k.Get(key).Allow()
+}
+
+// Get returns the limiter of the key, creating it if needed.
+func (k *Keyed) Get(key string) RateLimiter {
+	now := k.clock.Now()
+	s := k.shards[fnv32a(key)%uint32(len(k.shards))]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// the least recently used entries are at the back.
+	for el := s.lru.Back(); el != nil && k.expired(el.Value.(*keyedEntry), now); el = s.lru.Back() {
+		s.remove(el)
+	}
+	if el, ok := s.items[key]; ok {
+		e := el.Value.(*keyedEntry)
+		e.lastUsed = now
+		s.lru.MoveToFront(el)
+		return e.limiter
+	}
+	for s.maxKeys > 0 && s.lru.Len() >= s.maxKeys {
+		s.remove(s.lru.Back())
+	}
+	e := &keyedEntry{key: key, limiter: k.factory(key), lastUsed: now}
+	s.items[key] = s.lru.PushFront(e)
+	return e.limiter
+}
+
+// Len returns the number of tracked keys, including the expired keys not
+// evicted yet.
+func (k *Keyed) Len() (n int) {
+	for _, s := range k.shards {
+		s.mu.Lock()
+		n += s.lru.Len()
+		s.mu.Unlock()
+	}
+	return
+}
+
+func (k *Keyed) expired(e *keyedEntry, now time.Time) bool {
+	return k.ttl > 0 && now.Sub(e.lastUsed) >= k.ttl
+}
+
+func (s *shard) remove(el *list.Element) {
+	s.lru.Remove(el)
+	delete(s.items, el.Value.(*keyedEntry).key)
+}
+
+// fnv32a is the FNV-1a hash of the key, inlined to avoid allocations.
+func fnv32a(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
+}
@@ -0,0 +1,116 @@
+package ratelimiter
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock/manual"
+	"github.com/stretchr/testify/assert"
+)
+
+type testLimiter struct {
+	key     string
+	allowed int
+}
+
+func (l *testLimiter) Allow() (DoneFunc, error) {
+	if l.allowed == 0 {
+		return nil, ErrLimitExceed
+	}
+	l.allowed--
+	return func(DoneInfo) {}, nil
+}
+
+func newTestLimiter(key string) RateLimiter {
+	return &testLimiter{key: key, allowed: 1}
+}
+
+func TestKeyedAllow(t *testing.T) {
+	k := NewKeyed(newTestLimiter)
+	_, err := k.Allow("key_0")
+	assert.Nil(t, err)
+	_, err = k.Allow("key_0")
+	assert.Equal(t, ErrLimitExceed, err)
+	_, err = k.Allow("key_1")
+	assert.Nil(t, err)
+	assert.Equal(t, "key_1", k.Get("key_1").(*testLimiter).key)
+	assert.Equal(t, 2, k.Len())
+}
+
+func TestKeyedMaxKeys(t *testing.T) {
+	k := NewKeyed(newTestLimiter, WithShards(1), WithMaxKeys(2))
+	l0 := k.Get("key_0")
+	k.Get("key_1")
+	// key_0 becomes the most recently used key.
+	assert.Same(t, l0, k.Get("key_0"))
+	k.Get("key_2")
+	assert.Equal(t, 2, k.Len())
+	assert.Same(t, l0, k.Get("key_0"))
+
+	// key_1 was evicted and starts over.
+	_, err := k.Allow("key_1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, k.Len())
+}
+
+func TestKeyedMaxKeysShards(t *testing.T) {
+	for _, max := range []int{2, 100} {
+		k := NewKeyed(newTestLimiter, WithMaxKeys(max))
+		for i := 0; i < 1000; i++ {
+			k.Get(strconv.Itoa(i))
+		}
+		assert.LessOrEqual(t, k.Len(), max)
+	}
+	assert.Len(t, NewKeyed(newTestLimiter, WithMaxKeys(2)).shards, 2)
+}
+
+func TestKeyedTTL(t *testing.T) {
+	c := manual.New(time.Unix(1000, 0))
+	k := NewKeyed(newTestLimiter, WithShards(1), WithTTL(time.Minute), WithClock(c))
+	l0 := k.Get("key_0")
+	k.Get("key_1")
+	c.Advance(30 * time.Second)
+	assert.Same(t, l0, k.Get("key_0"))
+
+	c.Advance(30 * time.Second)
+	// key_1 expired and is evicted on the next Get.
+	assert.Same(t, l0, k.Get("key_0"))
+	assert.Equal(t, 1, k.Len())
+
+	c.Advance(time.Minute)
+	assert.NotSame(t, l0, k.Get("key_0"))
+}
+
+func TestKeyedConcurrent(t *testing.T) {
+	k := NewKeyed(newTestLimiter, WithShards(4), WithMaxKeys(100))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				k.Get(strconv.Itoa(i*1000 + j))
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, k.Len(), 100)
+}
+
+func BenchmarkKeyed(b *testing.B) {
+	k := NewKeyed(newTestLimiter, WithMaxKeys(1024))
+	keys := make([]string, 4096)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			k.Get(keys[i%len(keys)])
+			i++
+		}
+	})
+}
@@ -3,10 +3,10 @@ package lbbr
 import (
 	"fmt"
 	"math"
-	"runtime"
 	"sync/atomic"
 	"time"
 
+	"github.com/devexps/go-pkg/v2/clock"
 	"github.com/devexps/go-pkg/v2/ratelimiter"
 	"github.com/devexps/go-pkg/v2/window"
 )
@@ -19,14 +19,21 @@ type LBBR struct {
 	passStat        window.RollingCounter
 	rtStat          window.RollingCounter
 	inFlight        int64
+	allowed         int64
+	dropped         int64
 	bucketPerSecond int64
 	bucketDuration  time.Duration
 
-	// prevDropTime defines previous start drop since initTime
-	prevDropTime atomic.Value
+	// prevDropTime defines previous start drop since initTime, per priority
+	prevDropTime [PriorityBatch + 1]atomic.Value
 	maxPASSCache atomic.Value
 	minRtCache   atomic.Value
 
+	queue waitQueue
+
+	// err is the error of starting the default cpu sampler
+	err error
+
 	opts options
 }
 
@@ -36,14 +43,17 @@ func NewLimiter(opts ...Option) *LBBR {
 		Window:       time.Second * 10,
 		Bucket:       100,
 		CPUThreshold: 800,
+		MaxQueue:     100,
+		QueueTarget:  time.Millisecond * 5,
+		Clock:        clock.New(),
 	}
 	for _, o := range opts {
 		o(&opt)
 	}
 
 	bucketDuration := opt.Window / time.Duration(opt.Bucket)
-	passStat := window.NewRollingCounter(window.RollingCounterOpts{Size: opt.Bucket, BucketDuration: bucketDuration})
-	rtStat := window.NewRollingCounter(window.RollingCounterOpts{Size: opt.Bucket, BucketDuration: bucketDuration})
+	passStat := window.NewRollingCounter(window.RollingCounterOpts{Size: opt.Bucket, BucketDuration: bucketDuration, Clock: opt.Clock})
+	rtStat := window.NewRollingCounter(window.RollingCounterOpts{Size: opt.Bucket, BucketDuration: bucketDuration, Clock: opt.Clock})
 
 	limiter := &LBBR{
 		opts:            opt,
@@ -51,19 +61,52 @@ func NewLimiter(opts ...Option) *LBBR {
 		rtStat:          rtStat,
 		bucketDuration:  bucketDuration,
 		bucketPerSecond: int64(time.Second / bucketDuration),
-		cpu:             func() int64 { return atomic.LoadInt64(&gCPU) },
 	}
 
-	if opt.CPUQuota != 0 {
-		// if cpuQuota is set, use new cpuGetter,Calculate the real CPU value based on the number of CPUs and Quota.
-		limiter.cpu = func() int64 {
-			return int64(float64(atomic.LoadInt64(&gCPU)) * float64(runtime.NumCPU()) / opt.CPUQuota)
+	// the shared sampler is started only when the cpu is used.
+	limiter.cpu = func() int64 { return 0 }
+	if opt.CPUSampler != nil {
+		limiter.cpu = cpuUsage(opt.CPUSampler.Usage, opt.CPUQuota)
+	} else if usesCPU(opt.Signals) {
+		usage, err := getDefaultUsage()
+		if err != nil {
+			limiter.err = fmt.Errorf("lbbr: cpu sampler: %w", err)
+		}
+		limiter.cpu = cpuUsage(movingAverage(opt.Clock, usage), opt.CPUQuota)
+	}
+	if len(opt.Signals) != 0 {
+		limiter.opts.Signals = make([]Signal, len(opt.Signals))
+		for i, s := range opt.Signals {
+			switch ss := s.(type) {
+			case *cpuSignal:
+				s = limiter.cpuSignal(ss)
+			case *sampledSignal:
+				s = ss.withClock(opt.Clock)
+			}
+			limiter.opts.Signals[i] = s
 		}
 	}
 
 	return limiter
 }
 
+// Err returns the error of starting the cpu sampler shared by the limiters,
+// the cpu usage of the limiter then stays zero and the cpu never overloads.
+// It is nil with WithCPUSampler or signals without the cpu.
+func (l *LBBR) Err() error {
+	return l.err
+}
+
+// cpuSignal returns the CPUSignal scaled to the cpu quota of the limiter,
+// on the cpu of the limiter without a sampler of its own.
+func (l *LBBR) cpuSignal(s *cpuSignal) Signal {
+	if s.sampler == nil {
+		return NewSignal(func() float64 { return float64(l.cpu()) }, s.threshold)
+	}
+	getter := cpuUsage(s.sampler.Usage, l.opts.CPUQuota)
+	return NewSignal(func() float64 { return float64(getter()) }, s.threshold)
+}
+
 func (l *LBBR) maxPASS() int64 {
 	passCache := l.maxPASSCache.Load()
 	if passCache != nil {
@@ -86,7 +129,7 @@ func (l *LBBR) maxPASS() int64 {
 	}))
 	l.maxPASSCache.Store(&counterCache{
 		val:  rawMaxPass,
-		time: time.Now(),
+		time: l.opts.Clock.Now(),
 	})
 	return rawMaxPass
 }
@@ -95,7 +138,7 @@ func (l *LBBR) maxPASS() int64 {
 // since lastTime, if it is one bucket duration earlier than
 // the last recorded time, it will return the BucketNum.
 func (l *LBBR) timespan(lastTime time.Time) int {
-	v := int(time.Since(lastTime) / l.bucketDuration)
+	v := int(l.opts.Clock.Since(lastTime) / l.bucketDuration)
 	if v > -1 {
 		return v
 	}
@@ -131,7 +174,7 @@ func (l *LBBR) minRT() int64 {
 	}
 	l.minRtCache.Store(&counterCache{
 		val:  rawMinRT,
-		time: time.Now(),
+		time: l.opts.Clock.Now(),
 	})
 	return rawMinRT
 }
@@ -144,38 +187,55 @@ func (l *LBBR) maxInFlight2() int64 {
 	return int64(math.Floor(float64(l.maxPASS()*l.minRT()*l.bucketPerSecond)/1000.0) + 0.5)
 }
 
-func (l *LBBR) shouldDrop() bool {
-	now := time.Duration(time.Now().UnixNano())
-	if l.cpu() < l.opts.CPUThreshold {
-		// current cpu payload below the threshold
-		prevDropTime, _ := l.prevDropTime.Load().(time.Duration)
-		if prevDropTime == 0 {
+// shouldDrop reports whether a request of the priority should be dropped.
+func (l *LBBR) shouldDrop(p Priority) bool {
+	drop, _ := l.drop(p)
+	return drop
+}
+
+// drop is shouldDrop with the reason of the drop, the drop cool-down
+// is tracked per priority.
+func (l *LBBR) drop(p Priority) (bool, DropReason) {
+	fraction := p.fraction()
+	prevDropTime := &l.prevDropTime[p.index()]
+	now := time.Duration(l.opts.Clock.Now().UnixNano())
+	if !l.overloaded() {
+		// current payload below the threshold
+		prevDrop, _ := prevDropTime.Load().(time.Duration)
+		if prevDrop == 0 {
 			// haven't start drop,
 			// accept current request
-			return false
+			return false, 0
 		}
-		if time.Duration(now-prevDropTime) <= time.Second {
+		if time.Duration(now-prevDrop) <= time.Second {
 			// just start drop one second ago,
 			// check current inflight count
-			inFlight := atomic.LoadInt64(&l.inFlight)
-			return inFlight > 1 && inFlight > l.maxInFlight()
+			return l.overInFlight(fraction), DropCoolDown
 		}
-		l.prevDropTime.Store(time.Duration(0))
-		return false
+		prevDropTime.Store(time.Duration(0))
+		return false, 0
 	}
-	// current cpu payload exceeds the threshold
-	inFlight := atomic.LoadInt64(&l.inFlight)
-	drop := inFlight > 1 && inFlight > l.maxInFlight()
+	// current payload exceeds the threshold
+	drop := l.overInFlight(fraction)
 	if drop {
-		prevDrop, _ := l.prevDropTime.Load().(time.Duration)
+		prevDrop, _ := prevDropTime.Load().(time.Duration)
 		if prevDrop != 0 {
 			// already started drop, return directly
-			return drop
+			return drop, DropOverload
 		}
 		// store start drop time
-		l.prevDropTime.Store(now)
+		prevDropTime.Store(now)
 	}
-	return drop
+	return drop, DropOverload
+}
+
+func (l *LBBR) overInFlight(fraction float64) bool {
+	inFlight := atomic.LoadInt64(&l.inFlight)
+	maxInFlight := l.maxInFlight()
+	if fraction < 1 {
+		maxInFlight = int64(float64(maxInFlight) * fraction)
+	}
+	return inFlight > 1 && inFlight > maxInFlight
 }
 
 // Stat tasks a snapshot of the L-BBR limiter.
@@ -186,22 +246,29 @@ func (l *LBBR) Stat() Stat {
 		MaxPass:     l.maxPASS(),
 		MaxInFlight: l.maxInFlight(),
 		InFlight:    atomic.LoadInt64(&l.inFlight),
+		Allowed:     atomic.LoadInt64(&l.allowed),
+		Dropped:     atomic.LoadInt64(&l.dropped),
+		Queued:      atomic.LoadInt64(&l.queue.length),
 	}
 }
 
 // Allow checks all inbound traffic.
 // Once overload is detected, it raises limit.ErrLimitExceed error.
 func (l *LBBR) Allow() (ratelimiter.DoneFunc, error) {
-	if l.shouldDrop() {
-		return nil, ratelimiter.ErrLimitExceed
-	}
+	return l.AllowWithPriority(PriorityCritical)
+}
+
+// pass takes an in-flight slot and returns the DoneFunc releasing it.
+func (l *LBBR) pass() ratelimiter.DoneFunc {
+	atomic.AddInt64(&l.allowed, 1)
 	atomic.AddInt64(&l.inFlight, 1)
-	start := time.Now().UnixNano()
+	start := l.opts.Clock.Now().UnixNano()
 	ms := float64(time.Millisecond)
 	return func(ratelimiter.DoneInfo) {
-		rt := int64(math.Ceil(float64(time.Now().UnixNano()-start)) / ms)
+		rt := int64(math.Ceil(float64(l.opts.Clock.Now().UnixNano()-start)) / ms)
 		l.rtStat.Add(rt)
 		atomic.AddInt64(&l.inFlight, -1)
 		l.passStat.Add(1)
-	}, nil
+		l.wake()
+	}
 }
@@ -8,6 +8,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/devexps/go-pkg/v2/clock/manual"
+	"github.com/devexps/go-pkg/v2/cpu"
 	"github.com/devexps/go-pkg/v2/ratelimiter"
 	"github.com/devexps/go-pkg/v2/window"
 
@@ -27,6 +29,11 @@ var (
 	}
 )
 
+func newTestLimiter() (*LBBR, *manual.Clock) {
+	c := manual.New(time.Now())
+	return NewLimiter(append(optsForTest, WithClock(c))...), c
+}
+
 func TestAllowRate(t *testing.T) {
 	limiter := NewLimiter(optsForTest...)
 	var wg sync.WaitGroup
@@ -55,10 +62,10 @@ func TestAllowRate(t *testing.T) {
 
 func TestMaxPass(t *testing.T) {
 	bucketDuration := windowSizeTest / time.Duration(bucketNumTest)
-	limiter := NewLimiter(optsForTest...)
+	limiter, c := newTestLimiter()
 	for i := 1; i <= 10; i++ {
 		limiter.passStat.Add(int64(i * 100))
-		time.Sleep(bucketDuration)
+		c.Advance(bucketDuration)
 	}
 	assert.Equal(t, int64(1000), limiter.maxPASS())
 
@@ -69,74 +76,74 @@ func TestMaxPass(t *testing.T) {
 
 func TestMaxPassWithCache(t *testing.T) {
 	bucketDuration := windowSizeTest / time.Duration(bucketNumTest)
-	limiter := NewLimiter(optsForTest...)
+	limiter, c := newTestLimiter()
 	// witch cache, value of the latest bucket is not counted instantly.
 	// after a bucket duration time, this bucket will be fully counted.
 	limiter.passStat.Add(int64(50))
-	time.Sleep(bucketDuration / 2)
+	c.Advance(bucketDuration / 2)
 	assert.Equal(t, int64(1), limiter.maxPASS())
 
 	limiter.passStat.Add(int64(50))
-	time.Sleep(bucketDuration / 2)
+	c.Advance(bucketDuration / 2)
 	assert.Equal(t, int64(1), limiter.maxPASS())
 
 	limiter.passStat.Add(int64(1))
-	time.Sleep(bucketDuration)
+	c.Advance(bucketDuration)
 	assert.Equal(t, int64(100), limiter.maxPASS())
 }
 
 func TestMinRt(t *testing.T) {
 	bucketDuration := windowSizeTest / time.Duration(bucketNumTest)
-	limiter := NewLimiter(optsForTest...)
+	limiter, c := newTestLimiter()
 	for i := 0; i < 10; i++ {
 		for j := i*10 + 1; j <= i*10+10; j++ {
 			limiter.rtStat.Add(int64(j))
 		}
 		if i != 9 {
-			time.Sleep(bucketDuration)
+			c.Advance(bucketDuration)
 		}
 	}
 	assert.Equal(t, int64(6), limiter.minRT())
 
 	// default max min rt is equal to maxFloat64.
-	limiter = NewLimiter(optsForTest...)
-	limiter.rtStat = window.NewRollingCounter(window.RollingCounterOpts{Size: 10, BucketDuration: bucketDuration})
+	limiter, c = newTestLimiter()
+	limiter.rtStat = window.NewRollingCounter(window.RollingCounterOpts{Size: 10, BucketDuration: bucketDuration, Clock: c})
 	assert.Equal(t, int64(math.Ceil(math.MaxFloat64)), limiter.minRT())
 }
 
 func TestMinRtWithCache(t *testing.T) {
 	bucketDuration := windowSizeTest / time.Duration(bucketNumTest)
-	limiter := NewLimiter(optsForTest...)
+	limiter, c := newTestLimiter()
 	for i := 0; i < 10; i++ {
 		for j := i*10 + 1; j <= i*10+5; j++ {
 			limiter.rtStat.Add(int64(j))
 		}
 		if i != 9 {
-			time.Sleep(bucketDuration / 2)
+			c.Advance(bucketDuration / 2)
 		}
 		_ = limiter.minRT()
 		for j := i*10 + 6; j <= i*10+10; j++ {
 			limiter.rtStat.Add(int64(j))
 		}
 		if i != 9 {
-			time.Sleep(bucketDuration / 2)
+			c.Advance(bucketDuration / 2)
 		}
 	}
 	assert.Equal(t, int64(6), limiter.minRT())
 }
 
 func TestMaxQps(t *testing.T) {
-	limiter := NewLimiter(optsForTest...)
+	limiter, c := newTestLimiter()
 	bucketDuration := windowSizeTest / time.Duration(bucketNumTest)
-	passStat := window.NewRollingCounter(window.RollingCounterOpts{Size: 10, BucketDuration: bucketDuration})
-	rtStat := window.NewRollingCounter(window.RollingCounterOpts{Size: 10, BucketDuration: bucketDuration})
+	passStat := window.NewRollingCounter(window.RollingCounterOpts{Size: 10, BucketDuration: bucketDuration, Clock: c})
+	rtStat := window.NewRollingCounter(window.RollingCounterOpts{Size: 10, BucketDuration: bucketDuration, Clock: c})
 	for i := 0; i < 10; i++ {
 		passStat.Add(int64((i + 2) * 100))
 		for j := i*10 + 1; j <= i*10+10; j++ {
 			rtStat.Add(int64(j))
 		}
 		if i != 9 {
-			time.Sleep(bucketDuration)
+			c.Advance(bucketDuration)
 		}
 	}
 	limiter.passStat = passStat
@@ -146,20 +153,20 @@ func TestMaxQps(t *testing.T) {
 
 func TestShouldDrop(t *testing.T) {
 	var cpu int64
-	limiter := NewLimiter(optsForTest...)
+	limiter, c := newTestLimiter()
 	limiter.cpu = func() int64 {
 		return cpu
 	}
 	bucketDuration := windowSizeTest / time.Duration(bucketNumTest)
-	passStat := window.NewRollingCounter(window.RollingCounterOpts{Size: 10, BucketDuration: bucketDuration})
-	rtStat := window.NewRollingCounter(window.RollingCounterOpts{Size: 10, BucketDuration: bucketDuration})
+	passStat := window.NewRollingCounter(window.RollingCounterOpts{Size: 10, BucketDuration: bucketDuration, Clock: c})
+	rtStat := window.NewRollingCounter(window.RollingCounterOpts{Size: 10, BucketDuration: bucketDuration, Clock: c})
 	for i := 0; i < 10; i++ {
 		passStat.Add(int64((i + 1) * 100))
 		for j := i*10 + 1; j <= i*10+10; j++ {
 			rtStat.Add(int64(j))
 		}
 		if i != 9 {
-			time.Sleep(bucketDuration)
+			c.Advance(bucketDuration)
 		}
 	}
 	limiter.passStat = passStat
@@ -168,23 +175,23 @@ func TestShouldDrop(t *testing.T) {
 	// cpu >=  800, inflight < maxQps
 	cpu = 800
 	limiter.inFlight = 50
-	assert.Equal(t, false, limiter.shouldDrop())
+	assert.Equal(t, false, limiter.shouldDrop(PriorityCritical))
 
 	// cpu >=  800, inflight > maxQps
 	cpu = 800
 	limiter.inFlight = 80
-	assert.Equal(t, true, limiter.shouldDrop())
+	assert.Equal(t, true, limiter.shouldDrop(PriorityCritical))
 
 	// cpu < 800, inflight > maxQps, cold duration
 	cpu = 700
 	limiter.inFlight = 80
-	assert.Equal(t, true, limiter.shouldDrop())
+	assert.Equal(t, true, limiter.shouldDrop(PriorityCritical))
 
 	// cpu < 800, inflight > maxQps
-	time.Sleep(2 * time.Second)
+	c.Advance(2 * time.Second)
 	cpu = 700
 	limiter.inFlight = 80
-	assert.Equal(t, false, limiter.shouldDrop())
+	assert.Equal(t, false, limiter.shouldDrop(PriorityCritical))
 }
 
 func BenchmarkAllowUnderLowLoad(b *testing.B) {
@@ -200,3 +207,30 @@ func BenchmarkAllowUnderLowLoad(b *testing.B) {
 		}
 	}
 }
+
+func TestWithCPUSampler(t *testing.T) {
+	s := cpu.NewSampler(time.Second, 0)
+	limiter := NewLimiter(append(optsForTest, WithCPUSampler(s), WithCPUQuota(1))...)
+	// the sampler is not started by the limiter.
+	assert.Equal(t, int64(0), limiter.Stat().CPU)
+	_, err := limiter.Allow()
+	assert.Nil(t, err)
+	assert.Nil(t, limiter.Err())
+}
+
+func TestMovingAverage(t *testing.T) {
+	c := manual.New(time.Now())
+	var usage uint64 = 1000
+	avg := movingAverage(c, func() uint64 { return usage })
+	assert.Equal(t, uint64(1000), avg())
+
+	// a missing sample is skipped.
+	usage = 0
+	c.Advance(signalInterval)
+	assert.Equal(t, uint64(1000), avg())
+
+	// decayed by 0.95 over a cpu interval.
+	usage = 500
+	c.Advance(cpuInterval - signalInterval)
+	assert.Equal(t, uint64(975), avg())
+}
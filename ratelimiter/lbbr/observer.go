@@ -0,0 +1,45 @@
+package lbbr
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// DropReason is the reason why a request is dropped.
+type DropReason int
+
+const (
+	// DropOverload the limiter is overloaded and the in-flight
+	// requests exceed the budget.
+	DropOverload DropReason = iota + 1
+	// DropCoolDown the limiter is no longer overloaded but the in-flight
+	// requests still exceed the budget within a second of the last overload.
+	DropCoolDown
+	// DropWaitTimeout the request waited in the queue of AllowCtx until its
+	// context was done.
+	DropWaitTimeout
+)
+
+func (r DropReason) String() string {
+	switch r {
+	case DropOverload:
+		return "overload"
+	case DropCoolDown:
+		return "cool-down"
+	case DropWaitTimeout:
+		return "wait-timeout"
+	}
+	return fmt.Sprintf("DropReason(%d)", int(r))
+}
+
+// Observer is called with a snapshot of the limiter and the reason
+// of a dropped request.
+type Observer func(stat Stat, reason DropReason)
+
+// reject counts a dropped request and notifies the observer.
+func (l *LBBR) reject(reason DropReason) {
+	atomic.AddInt64(&l.dropped, 1)
+	if l.opts.Observer != nil {
+		l.opts.Observer(l.Stat(), reason)
+	}
+}
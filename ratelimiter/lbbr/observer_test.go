@@ -0,0 +1,93 @@
+package lbbr
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserver(t *testing.T) {
+	var (
+		reasons []DropReason
+		last    Stat
+	)
+	cpu := int64(800)
+	limiter, _ := newOverloadedLimiter()
+	limiter.cpu = func() int64 { return cpu }
+	limiter.opts.Observer = func(stat Stat, reason DropReason) {
+		reasons = append(reasons, reason)
+		last = stat
+	}
+
+	limiter.inFlight = 10
+	done, err := limiter.Allow()
+	assert.Nil(t, err)
+	done(ratelimiter.DoneInfo{})
+	assert.Empty(t, reasons)
+
+	limiter.inFlight = 80
+	_, err = limiter.Allow()
+	assert.Equal(t, ratelimiter.ErrLimitExceed, err)
+	cpu = 700
+	_, err = limiter.Allow()
+	assert.Equal(t, ratelimiter.ErrLimitExceed, err)
+
+	assert.Equal(t, []DropReason{DropOverload, DropCoolDown}, reasons)
+	assert.Equal(t, int64(80), last.InFlight)
+	assert.Equal(t, int64(1), last.Allowed)
+	assert.Equal(t, int64(2), last.Dropped)
+	assert.Equal(t, "cool-down", DropCoolDown.String())
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("closed")
+}
+
+func TestWritePrometheus(t *testing.T) {
+	var buf bytes.Buffer
+	err := WritePrometheus(&buf, map[string]Stat{
+		"b":          {CPU: 800, InFlight: 3, MaxInFlight: 54, MinRt: 6, MaxPass: 1000, Allowed: 10, Dropped: 2, Queued: 4},
+		`a"\` + "\n": {},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, `# HELP lbbr_cpu CPU usage in per mille.
+# TYPE lbbr_cpu gauge
+lbbr_cpu{limiter="a\"\\\n"} 0
+lbbr_cpu{limiter="b"} 800
+# HELP lbbr_in_flight Requests in flight.
+# TYPE lbbr_in_flight gauge
+lbbr_in_flight{limiter="a\"\\\n"} 0
+lbbr_in_flight{limiter="b"} 3
+# HELP lbbr_max_in_flight Estimated maximum requests in flight.
+# TYPE lbbr_max_in_flight gauge
+lbbr_max_in_flight{limiter="a\"\\\n"} 0
+lbbr_max_in_flight{limiter="b"} 54
+# HELP lbbr_min_rt_milliseconds Minimum average round-trip time of a bucket.
+# TYPE lbbr_min_rt_milliseconds gauge
+lbbr_min_rt_milliseconds{limiter="a\"\\\n"} 0
+lbbr_min_rt_milliseconds{limiter="b"} 6
+# HELP lbbr_max_pass Maximum requests passed in a bucket.
+# TYPE lbbr_max_pass gauge
+lbbr_max_pass{limiter="a\"\\\n"} 0
+lbbr_max_pass{limiter="b"} 1000
+# HELP lbbr_allowed_total Requests allowed.
+# TYPE lbbr_allowed_total counter
+lbbr_allowed_total{limiter="a\"\\\n"} 0
+lbbr_allowed_total{limiter="b"} 10
+# HELP lbbr_dropped_total Requests dropped.
+# TYPE lbbr_dropped_total counter
+lbbr_dropped_total{limiter="a\"\\\n"} 0
+lbbr_dropped_total{limiter="b"} 2
+# HELP lbbr_queued Requests waiting in the queue.
+# TYPE lbbr_queued gauge
+lbbr_queued{limiter="a\"\\\n"} 0
+lbbr_queued{limiter="b"} 4
+`, buf.String())
+
+	assert.NotNil(t, WritePrometheus(failingWriter{}, map[string]Stat{"b": {}}))
+}
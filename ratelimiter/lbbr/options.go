@@ -1,6 +1,11 @@
 package lbbr
 
-import "time"
+import (
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock"
+	"github.com/devexps/go-pkg/v2/cpu"
+)
 
 // Option function for L-BBR limiter
 type Option func(*options)
@@ -15,6 +20,20 @@ type options struct {
 	CPUThreshold int64
 	// CPUQuota
 	CPUQuota float64
+	// Clock is the time source of the limiter
+	Clock clock.Clock
+	// Signals replace the cpu threshold to detect the overload
+	Signals []Signal
+	// SignalMode defines the way the signals are combined
+	SignalMode SignalMode
+	// CPUSampler is the source of the cpu usage
+	CPUSampler *cpu.Sampler
+	// Observer is called on every dropped request
+	Observer Observer
+	// MaxQueue defines the number of requests waiting in AllowCtx
+	MaxQueue int
+	// QueueTarget defines the wait after which the queue is served in LIFO order
+	QueueTarget time.Duration
 }
 
 // WithWindow with window size.
@@ -44,3 +63,59 @@ func WithCPUQuota(quota float64) Option {
 		o.CPUQuota = quota
 	}
 }
+
+// WithClock with the time source of the limiter, default is the wall clock.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.Clock = c
+	}
+}
+
+// WithSignals with the overload signals replacing the cpu threshold,
+// CPUSignal keeps the cpu among them.
+func WithSignals(signals ...Signal) Option {
+	return func(o *options) {
+		o.Signals = signals
+	}
+}
+
+// WithSignalMode with the way the signals are combined, default is SignalAny.
+func WithSignalMode(m SignalMode) Option {
+	return func(o *options) {
+		o.SignalMode = m
+	}
+}
+
+// WithCPUSampler with the source of the cpu usage, the caller starts and
+// stops it. By default the limiters share the moving average of
+// cpu.DefaultSampler, started by the first of them using the cpu, see
+// CPUSignal and LBBR.Err.
+func WithCPUSampler(s *cpu.Sampler) Option {
+	return func(o *options) {
+		o.CPUSampler = s
+	}
+}
+
+// WithObserver with the function called on every dropped request,
+// it runs on the request path and must be fast.
+func WithObserver(o Observer) Option {
+	return func(opts *options) {
+		opts.Observer = o
+	}
+}
+
+// WithMaxQueue with the number of requests allowed to wait in AllowCtx,
+// default is 100.
+func WithMaxQueue(n int) Option {
+	return func(o *options) {
+		o.MaxQueue = n
+	}
+}
+
+// WithQueueTarget with the wait of the oldest request after which the queue
+// of AllowCtx is served in LIFO order until it drains, default is 5ms.
+func WithQueueTarget(d time.Duration) Option {
+	return func(o *options) {
+		o.QueueTarget = d
+	}
+}
@@ -0,0 +1,68 @@
+package lbbr
+
+import (
+	"context"
+
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+)
+
+// Priority is the importance of a request, the less important requests are
+// dropped first under overload.
+type Priority int
+
+const (
+	// PriorityCritical requests keep the full in-flight budget.
+	PriorityCritical Priority = iota
+	// PriorityHigh requests are dropped above 90% of the in-flight budget.
+	PriorityHigh
+	// PriorityLow requests are dropped above 75% of the in-flight budget.
+	PriorityLow
+	// PriorityBatch requests are dropped above 50% of the in-flight budget.
+	PriorityBatch
+)
+
+// fraction returns the fraction of maxInFlight available to the priority.
+func (p Priority) fraction() float64 {
+	switch p {
+	case PriorityCritical:
+		return 1.0
+	case PriorityHigh:
+		return 0.9
+	case PriorityLow:
+		return 0.75
+	}
+	return 0.5
+}
+
+// index returns the index of the priority in [0, PriorityBatch], the
+// unknown priorities are batch ones.
+func (p Priority) index() int {
+	if p < PriorityCritical || p > PriorityBatch {
+		return int(PriorityBatch)
+	}
+	return int(p)
+}
+
+type priorityKey struct{}
+
+// NewPriorityContext returns a new Context that carries the priority.
+func NewPriorityContext(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext returns the priority carried by ctx,
+// PriorityCritical if there is none.
+func PriorityFromContext(ctx context.Context) Priority {
+	p, _ := ctx.Value(priorityKey{}).(Priority)
+	return p
+}
+
+// AllowWithPriority checks the inbound traffic of the priority, Allow is
+// the same as AllowWithPriority(PriorityCritical).
+func (l *LBBR) AllowWithPriority(p Priority) (ratelimiter.DoneFunc, error) {
+	if drop, reason := l.drop(p); drop {
+		l.reject(reason)
+		return nil, ratelimiter.ErrLimitExceed
+	}
+	return l.pass(), nil
+}
@@ -0,0 +1,93 @@
+package lbbr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock/manual"
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+	"github.com/devexps/go-pkg/v2/window"
+	"github.com/stretchr/testify/assert"
+)
+
+// newOverloadedLimiter returns a limiter over the cpu threshold
+// with a maxInFlight of 54.
+func newOverloadedLimiter() (*LBBR, *manual.Clock) {
+	limiter, c := newTestLimiter()
+	limiter.cpu = func() int64 {
+		return 800
+	}
+	bucketDuration := windowSizeTest / time.Duration(bucketNumTest)
+	passStat := window.NewRollingCounter(window.RollingCounterOpts{Size: 10, BucketDuration: bucketDuration, Clock: c})
+	rtStat := window.NewRollingCounter(window.RollingCounterOpts{Size: 10, BucketDuration: bucketDuration, Clock: c})
+	for i := 0; i < 10; i++ {
+		passStat.Add(int64((i + 1) * 100))
+		for j := i*10 + 1; j <= i*10+10; j++ {
+			rtStat.Add(int64(j))
+		}
+		if i != 9 {
+			c.Advance(bucketDuration)
+		}
+	}
+	limiter.passStat = passStat
+	limiter.rtStat = rtStat
+	return limiter, c
+}
+
+func TestAllowWithPriority(t *testing.T) {
+	limiter, _ := newOverloadedLimiter()
+	assert.Equal(t, int64(54), limiter.maxInFlight())
+
+	for _, tt := range []struct {
+		inFlight int64
+		allowed  []Priority
+		dropped  []Priority
+	}{
+		{inFlight: 27, allowed: []Priority{PriorityCritical, PriorityHigh, PriorityLow, PriorityBatch}},
+		{inFlight: 40, allowed: []Priority{PriorityCritical, PriorityHigh, PriorityLow}, dropped: []Priority{PriorityBatch}},
+		{inFlight: 48, allowed: []Priority{PriorityCritical, PriorityHigh}, dropped: []Priority{PriorityLow, PriorityBatch}},
+		{inFlight: 54, allowed: []Priority{PriorityCritical}, dropped: []Priority{PriorityHigh, PriorityLow, PriorityBatch}},
+		{inFlight: 55, dropped: []Priority{PriorityCritical, PriorityHigh, PriorityLow, PriorityBatch}},
+	} {
+		for _, p := range tt.allowed {
+			limiter.inFlight = tt.inFlight
+			_, err := limiter.AllowWithPriority(p)
+			assert.Nil(t, err, "inFlight %d priority %d", tt.inFlight, p)
+		}
+		for _, p := range tt.dropped {
+			limiter.inFlight = tt.inFlight
+			_, err := limiter.AllowWithPriority(p)
+			assert.Equal(t, ratelimiter.ErrLimitExceed, err, "inFlight %d priority %d", tt.inFlight, p)
+		}
+	}
+}
+
+func TestPriorityContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, PriorityCritical, PriorityFromContext(ctx))
+	assert.Equal(t, PriorityBatch, PriorityFromContext(NewPriorityContext(ctx, PriorityBatch)))
+}
+
+func TestDropCoolDownPerPriority(t *testing.T) {
+	limiter, c := newOverloadedLimiter()
+	limiter.inFlight = 40
+	drop, reason := limiter.drop(PriorityBatch)
+	assert.True(t, drop)
+	assert.Equal(t, DropOverload, reason)
+
+	// below the cpu threshold, only the batch requests cool down.
+	limiter.cpu = func() int64 {
+		return 100
+	}
+	limiter.inFlight = 55
+	drop, reason = limiter.drop(PriorityCritical)
+	assert.False(t, drop)
+	assert.Equal(t, DropReason(0), reason)
+	drop, reason = limiter.drop(PriorityBatch)
+	assert.True(t, drop)
+	assert.Equal(t, DropCoolDown, reason)
+
+	c.Advance(time.Second + time.Millisecond)
+	assert.False(t, limiter.shouldDrop(PriorityBatch))
+}
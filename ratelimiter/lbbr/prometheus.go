@@ -0,0 +1,51 @@
+package lbbr
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+var prometheusMetrics = []struct {
+	name, typ, help string
+	value           func(Stat) int64
+}{
+	{"lbbr_cpu", "gauge", "CPU usage in per mille.", func(s Stat) int64 { return s.CPU }},
+	{"lbbr_in_flight", "gauge", "Requests in flight.", func(s Stat) int64 { return s.InFlight }},
+	{"lbbr_max_in_flight", "gauge", "Estimated maximum requests in flight.", func(s Stat) int64 { return s.MaxInFlight }},
+	{"lbbr_min_rt_milliseconds", "gauge", "Minimum average round-trip time of a bucket.", func(s Stat) int64 { return s.MinRt }},
+	{"lbbr_max_pass", "gauge", "Maximum requests passed in a bucket.", func(s Stat) int64 { return s.MaxPass }},
+	{"lbbr_allowed_total", "counter", "Requests allowed.", func(s Stat) int64 { return s.Allowed }},
+	{"lbbr_dropped_total", "counter", "Requests dropped.", func(s Stat) int64 { return s.Dropped }},
+	{"lbbr_queued", "gauge", "Requests waiting in the queue.", func(s Stat) int64 { return s.Queued }},
+}
+
+// WritePrometheus writes the stats of the limiters keyed by name in the
+// Prometheus text exposition format, the names are the "limiter" label, e.g.
+//
+//	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+//		_ = lbbr.WritePrometheus(w, map[string]lbbr.Stat{"api": limiter.Stat()})
+//	})
+func WritePrometheus(w io.Writer, stats map[string]Stat) error {
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, m := range prometheusMetrics {
+		bw.WriteString("# HELP " + m.name + " " + m.help + "\n")
+		bw.WriteString("# TYPE " + m.name + " " + m.typ + "\n")
+		for _, name := range names {
+			bw.WriteString(m.name + `{limiter="` + labelEscaper.Replace(name) + `"} `)
+			bw.WriteString(strconv.FormatInt(m.value(stats[name]), 10))
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
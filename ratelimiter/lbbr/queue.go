@@ -0,0 +1,137 @@
+package lbbr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+)
+
+var (
+	// ErrQueueFull is returned by AllowCtx when the request should be dropped
+	// and the wait queue is full, it matches ratelimiter.ErrLimitExceed with errors.Is.
+	ErrQueueFull = fmt.Errorf("lbbr: queue full: %w", ratelimiter.ErrLimitExceed)
+	// ErrWaitTimeout is returned by AllowCtx when the request is still queued
+	// at the deadline, it matches ratelimiter.ErrLimitExceed with errors.Is.
+	ErrWaitTimeout = fmt.Errorf("lbbr: wait timeout: %w", ratelimiter.ErrLimitExceed)
+)
+
+// waitQueue is the queue of the requests waiting for an in-flight slot.
+// It is served in FIFO order until the oldest waiter has waited longer than
+// the target, then in LIFO order until it drains, like CoDel the fresh
+// requests are served first under a standing queue, while the stale ones
+// are likely to time out anyway.
+type waitQueue struct {
+	mu      sync.Mutex
+	waiters []*waiter
+	lifo    bool
+	// length is the number of waiters, read without the lock.
+	length int64
+}
+
+type waiter struct {
+	priority Priority
+	since    time.Time
+	ready    chan struct{}
+}
+
+// AllowCtx is like Allow, but the requests to drop wait in a bounded queue
+// for another request to finish, until ctx is done. The priority carried by
+// ctx is used, see NewPriorityContext.
+func (l *LBBR) AllowCtx(ctx context.Context) (ratelimiter.DoneFunc, error) {
+	priority := PriorityFromContext(ctx)
+	drop, reason := l.drop(priority)
+	if !drop {
+		return l.pass(), nil
+	}
+	q := &l.queue
+	w := &waiter{priority: priority, since: l.opts.Clock.Now(), ready: make(chan struct{})}
+	q.mu.Lock()
+	if len(q.waiters) >= l.opts.MaxQueue {
+		q.mu.Unlock()
+		l.reject(reason)
+		return nil, ErrQueueFull
+	}
+	q.waiters = append(q.waiters, w)
+	atomic.AddInt64(&q.length, 1)
+	q.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return l.pass(), nil
+	case <-ctx.Done():
+	}
+	if !q.remove(w) {
+		// woken concurrently, hand the slot to the next waiter.
+		l.wake()
+	}
+	l.reject(DropWaitTimeout)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, ErrWaitTimeout
+	}
+	return nil, ctx.Err()
+}
+
+// wake lets the next waiter in once a request is done, the first one in
+// the serving order which would not be dropped, so a waiter of a low
+// priority does not hold back the more important ones.
+func (l *LBBR) wake() {
+	q := &l.queue
+	if atomic.LoadInt64(&q.length) == 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.waiters) == 0 {
+		return
+	}
+	if !q.lifo && l.opts.Clock.Since(q.waiters[0].since) > l.opts.QueueTarget {
+		q.lifo = true
+	}
+	// the drop decision of every priority is taken once.
+	var checked, dropped [PriorityBatch + 1]bool
+	for j := range q.waiters {
+		i := j
+		if q.lifo {
+			i = len(q.waiters) - 1 - j
+		}
+		w := q.waiters[i]
+		p := w.priority.index()
+		if !checked[p] {
+			checked[p] = true
+			dropped[p] = l.shouldDrop(w.priority)
+		}
+		if dropped[p] {
+			continue
+		}
+		q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+		atomic.AddInt64(&q.length, -1)
+		if len(q.waiters) == 0 {
+			q.lifo = false
+		}
+		close(w.ready)
+		return
+	}
+}
+
+// remove removes the waiter from the queue, and reports whether it was
+// still queued.
+func (q *waitQueue) remove(w *waiter) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, qw := range q.waiters {
+		if qw == w {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			atomic.AddInt64(&q.length, -1)
+			if len(q.waiters) == 0 {
+				q.lifo = false
+			}
+			return true
+		}
+	}
+	return false
+}
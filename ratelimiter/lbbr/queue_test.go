@@ -0,0 +1,132 @@
+package lbbr
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+	"github.com/stretchr/testify/assert"
+)
+
+type allowResult struct {
+	id   int
+	done ratelimiter.DoneFunc
+	err  error
+}
+
+// queueN starts n AllowCtx calls one after another, and waits for them to be queued.
+func queueN(t *testing.T, l *LBBR, ctx context.Context, n int, results chan allowResult) {
+	for i := 0; i < n; i++ {
+		queued := atomic.LoadInt64(&l.queue.length)
+		go func(id int) {
+			done, err := l.AllowCtx(ctx)
+			results <- allowResult{id: id, done: done, err: err}
+		}(i)
+		assert.Eventually(t, func() bool {
+			return atomic.LoadInt64(&l.queue.length) == queued+1
+		}, time.Second, time.Millisecond)
+	}
+}
+
+func TestAllowCtxWake(t *testing.T) {
+	limiter, _ := newOverloadedLimiter()
+	limiter.opts.QueueTarget = time.Hour
+	atomic.StoreInt64(&limiter.inFlight, 55)
+	results := make(chan allowResult, 2)
+	queueN(t, limiter, context.Background(), 2, results)
+	assert.Equal(t, int64(2), limiter.Stat().Queued)
+
+	// still over the budget.
+	limiter.wake()
+	assert.Equal(t, int64(2), atomic.LoadInt64(&limiter.queue.length))
+
+	// the waiters are served in FIFO order.
+	atomic.StoreInt64(&limiter.inFlight, 54)
+	limiter.wake()
+	r := <-results
+	assert.Nil(t, r.err)
+	assert.Equal(t, 0, r.id)
+	assert.Equal(t, int64(55), atomic.LoadInt64(&limiter.inFlight))
+
+	// a finished request lets the next waiter in.
+	r.done(ratelimiter.DoneInfo{})
+	r = <-results
+	assert.Nil(t, r.err)
+	assert.Equal(t, 1, r.id)
+	assert.Equal(t, int64(0), limiter.Stat().Queued)
+}
+
+func TestAllowCtxLIFO(t *testing.T) {
+	limiter, c := newOverloadedLimiter()
+	atomic.StoreInt64(&limiter.inFlight, 55)
+	results := make(chan allowResult, 3)
+	queueN(t, limiter, context.Background(), 3, results)
+
+	// the oldest waiter waited longer than the target.
+	c.Advance(10 * time.Millisecond)
+	atomic.StoreInt64(&limiter.inFlight, 50)
+	for _, id := range []int{2, 1, 0} {
+		limiter.wake()
+		assert.Equal(t, id, (<-results).id)
+	}
+	assert.False(t, limiter.queue.lifo)
+}
+
+func TestAllowCtxQueueFull(t *testing.T) {
+	limiter, _ := newOverloadedLimiter()
+	limiter.opts.MaxQueue = 1
+	atomic.StoreInt64(&limiter.inFlight, 80)
+	ctx, cancel := context.WithCancel(context.Background())
+	results := make(chan allowResult, 1)
+	queueN(t, limiter, ctx, 1, results)
+
+	_, err := limiter.AllowCtx(context.Background())
+	assert.Equal(t, ErrQueueFull, err)
+
+	cancel()
+	assert.Equal(t, context.Canceled, (<-results).err)
+	stat := limiter.Stat()
+	assert.Equal(t, int64(0), stat.Queued)
+	assert.Equal(t, int64(2), stat.Dropped)
+}
+
+func TestAllowCtxTimeout(t *testing.T) {
+	var reasons []DropReason
+	limiter, _ := newOverloadedLimiter()
+	limiter.opts.Observer = func(_ Stat, reason DropReason) {
+		reasons = append(reasons, reason)
+	}
+	atomic.StoreInt64(&limiter.inFlight, 80)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := limiter.AllowCtx(ctx)
+	assert.Equal(t, ErrWaitTimeout, err)
+	assert.Equal(t, []DropReason{DropWaitTimeout}, reasons)
+
+	// not queued when the request is allowed.
+	atomic.StoreInt64(&limiter.inFlight, 10)
+	done, err := limiter.AllowCtx(context.Background())
+	assert.Nil(t, err)
+	done(ratelimiter.DoneInfo{})
+}
+
+func TestAllowCtxWakePriority(t *testing.T) {
+	limiter, _ := newOverloadedLimiter()
+	limiter.opts.QueueTarget = time.Hour
+	atomic.StoreInt64(&limiter.inFlight, 55)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batch := make(chan allowResult, 1)
+	queueN(t, limiter, NewPriorityContext(ctx, PriorityBatch), 1, batch)
+	results := make(chan allowResult, 1)
+	queueN(t, limiter, ctx, 1, results)
+
+	// the batch waiter at the head does not hold back the critical one.
+	atomic.StoreInt64(&limiter.inFlight, 50)
+	limiter.wake()
+	assert.Nil(t, (<-results).err)
+	assert.Equal(t, int64(1), limiter.Stat().Queued)
+	assert.Len(t, batch, 0)
+}
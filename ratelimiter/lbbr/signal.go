@@ -0,0 +1,214 @@
+package lbbr
+
+import (
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock"
+	"github.com/devexps/go-pkg/v2/cpu"
+)
+
+// signalInterval is the minimum duration between two samples of the
+// runtime signals, reading the runtime metrics on every request is too costly.
+const signalInterval = 100 * time.Millisecond
+
+// SignalMode is the way several signals are combined.
+type SignalMode int
+
+const (
+	// SignalAny reports an overload when any signal reaches its threshold.
+	SignalAny SignalMode = iota
+	// SignalAll reports an overload when all signals reach their thresholds.
+	SignalAll
+)
+
+// Signal is an overload signal of the limiter, the limiter starts
+// dropping when the value reaches the threshold.
+type Signal interface {
+	Value() float64
+	Threshold() float64
+}
+
+type signal struct {
+	value     func() float64
+	threshold float64
+}
+
+func (s *signal) Value() float64     { return s.value() }
+func (s *signal) Threshold() float64 { return s.threshold }
+
+// NewSignal returns a Signal of the value function, e.g. the number of
+// goroutines or the depth of a queue.
+func NewSignal(value func() float64, threshold float64) Signal {
+	return &signal{value: value, threshold: threshold}
+}
+
+type cpuSignal struct {
+	sampler   *cpu.Sampler
+	threshold float64
+}
+
+func (s *cpuSignal) Value() float64 {
+	if s.sampler == nil {
+		// outside a limiter, the last sample of the default sampler.
+		usage, _ := getDefaultUsage()
+		return float64(cpuUsage(usage, 0)())
+	}
+	return float64(cpuUsage(s.sampler.Usage, 0)())
+}
+
+func (s *cpuSignal) Threshold() float64 { return s.threshold }
+
+// CPUSignal returns the Signal of the cpu usage of the sampler in per mille,
+// the same as the default cpu threshold. A nil sampler is the one of the
+// limiter, see WithCPUSampler. Within a limiter the usage is scaled to its
+// cpu quota, see WithCPUQuota.
+func CPUSignal(s *cpu.Sampler, threshold int64) Signal {
+	return &cpuSignal{sampler: s, threshold: float64(threshold)}
+}
+
+// sampledSignal is a Signal whose value is sampled at most once per
+// signalInterval, on the clock of the limiter within a limiter.
+type sampledSignal struct {
+	// newSample returns the function sampling the value at now.
+	newSample func() func(now time.Time) float64
+	threshold float64
+	value     func() float64
+}
+
+func newSampledSignal(newSample func() func(now time.Time) float64, threshold float64, c clock.Clock) *sampledSignal {
+	return &sampledSignal{
+		newSample: newSample,
+		threshold: threshold,
+		value:     sampled(c, newSample()),
+	}
+}
+
+func (s *sampledSignal) Value() float64     { return s.value() }
+func (s *sampledSignal) Threshold() float64 { return s.threshold }
+
+// withClock returns a copy of the signal sampled on the clock.
+func (s *sampledSignal) withClock(c clock.Clock) Signal {
+	return newSampledSignal(s.newSample, s.threshold, c)
+}
+
+// HeapSignal returns the Signal of the ratio of the Go heap to the
+// memory limit set by GOMEMLIMIT or debug.SetMemoryLimit, its value is
+// zero when there is no memory limit.
+func HeapSignal(ratio float64) Signal {
+	return newSampledSignal(func() func(time.Time) float64 {
+		samples := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+		return func(time.Time) float64 {
+			limit := debug.SetMemoryLimit(-1)
+			if limit <= 0 || limit == math.MaxInt64 {
+				return 0
+			}
+			metrics.Read(samples)
+			if samples[0].Value.Kind() != metrics.KindUint64 {
+				return 0
+			}
+			return float64(samples[0].Value.Uint64()) / float64(limit)
+		}
+	}, ratio, clock.New())
+}
+
+// GCPauseSignal returns the Signal of the fraction of the time spent
+// in stop-the-world GC pauses since the previous sample.
+func GCPauseSignal(fraction float64) Signal {
+	return newSampledSignal(func() func(time.Time) float64 {
+		var (
+			samples   = []metrics.Sample{{Name: "/gc/pauses:seconds"}}
+			prevPause float64
+			prevTime  time.Time
+		)
+		return func(now time.Time) float64 {
+			metrics.Read(samples)
+			if samples[0].Value.Kind() != metrics.KindFloat64Histogram {
+				return 0
+			}
+			pause := totalPause(samples[0].Value.Float64Histogram())
+			elapsed := now.Sub(prevTime).Seconds()
+			first := prevTime.IsZero()
+			delta := pause - prevPause
+			prevPause, prevTime = pause, now
+			if first || elapsed <= 0 {
+				return 0
+			}
+			return delta / elapsed
+		}
+	}, fraction, clock.New())
+}
+
+// totalPause estimates the total pause time of the histogram with
+// the middle of its buckets.
+func totalPause(h *metrics.Float64Histogram) (total float64) {
+	for i, count := range h.Counts {
+		lo, hi := h.Buckets[i], h.Buckets[i+1]
+		if math.IsInf(lo, -1) {
+			lo = hi
+		}
+		if math.IsInf(hi, 1) {
+			hi = lo
+		}
+		total += float64(count) * (lo + hi) / 2
+	}
+	return
+}
+
+// sampled returns a function calling f at most once per signalInterval of
+// the clock, the last value is returned in between.
+func sampled(c clock.Clock, f func(now time.Time) float64) func() float64 {
+	var (
+		mu    sync.Mutex
+		last  int64
+		value uint64
+	)
+	return func() float64 {
+		t := c.Now()
+		now := t.UnixNano()
+		if now-atomic.LoadInt64(&last) < int64(signalInterval) {
+			return math.Float64frombits(atomic.LoadUint64(&value))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if now-atomic.LoadInt64(&last) >= int64(signalInterval) {
+			atomic.StoreUint64(&value, math.Float64bits(f(t)))
+			atomic.StoreInt64(&last, now)
+		}
+		return math.Float64frombits(atomic.LoadUint64(&value))
+	}
+}
+
+// usesCPU reports whether the signals need the cpu sampler of the limiter,
+// which is the default cpu threshold or a CPUSignal without a sampler.
+func usesCPU(signals []Signal) bool {
+	if len(signals) == 0 {
+		return true
+	}
+	for _, s := range signals {
+		if cs, ok := s.(*cpuSignal); ok && cs.sampler == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// overloaded reports whether the signals of the limiter reach their
+// thresholds, by default the cpu usage is compared to CPUThreshold.
+func (l *LBBR) overloaded() bool {
+	if len(l.opts.Signals) == 0 {
+		return l.cpu() >= l.opts.CPUThreshold
+	}
+	anyMode := l.opts.SignalMode == SignalAny
+	for _, s := range l.opts.Signals {
+		// the first overload decides for any, the first non overload for all.
+		if over := s.Value() >= s.Threshold(); over == anyMode {
+			return over
+		}
+	}
+	return !anyMode
+}
@@ -0,0 +1,122 @@
+package lbbr
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock/manual"
+	"github.com/devexps/go-pkg/v2/cpu"
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverloaded(t *testing.T) {
+	var goroutines, queue float64
+	signals := []Signal{
+		NewSignal(func() float64 { return goroutines }, 1000),
+		NewSignal(func() float64 { return queue }, 10),
+	}
+	anyLimiter := NewLimiter(append(optsForTest, WithSignals(signals...))...)
+	allLimiter := NewLimiter(append(optsForTest, WithSignals(signals...), WithSignalMode(SignalAll))...)
+	for _, tt := range []struct {
+		goroutines, queue float64
+		any, all          bool
+	}{
+		{goroutines: 10, queue: 1, any: false, all: false},
+		{goroutines: 1000, queue: 1, any: true, all: false},
+		{goroutines: 10, queue: 20, any: true, all: false},
+		{goroutines: 1000, queue: 10, any: true, all: true},
+	} {
+		goroutines, queue = tt.goroutines, tt.queue
+		assert.Equal(t, tt.any, anyLimiter.overloaded(), "%v", tt)
+		assert.Equal(t, tt.all, allLimiter.overloaded(), "%v", tt)
+	}
+}
+
+func TestShouldDropWithSignals(t *testing.T) {
+	var queue float64
+	limiter, _ := newOverloadedLimiter()
+	limiter.opts.Signals = []Signal{NewSignal(func() float64 { return queue }, 10)}
+	// the cpu is ignored once signals are set.
+	limiter.inFlight = 80
+	assert.False(t, limiter.shouldDrop(PriorityCritical))
+	queue = 10
+	assert.True(t, limiter.shouldDrop(PriorityCritical))
+
+	_, err := limiter.Allow()
+	assert.Equal(t, ratelimiter.ErrLimitExceed, err)
+}
+
+func TestHeapSignal(t *testing.T) {
+	prev := debug.SetMemoryLimit(-1)
+	defer debug.SetMemoryLimit(prev)
+
+	debug.SetMemoryLimit(1 << 40)
+	s := HeapSignal(0.9)
+	assert.Equal(t, 0.9, s.Threshold())
+	v := s.Value()
+	assert.Greater(t, v, 0.0)
+	assert.Less(t, v, 0.9)
+}
+
+func TestGCPauseSignal(t *testing.T) {
+	c := manual.New(time.Now())
+	limiter := NewLimiter(append(optsForTest, WithClock(c), WithSignals(GCPauseSignal(0.1)))...)
+	s := limiter.opts.Signals[0]
+	assert.Equal(t, 0.0, s.Value())
+	// sampled on the clock of the limiter.
+	c.Advance(signalInterval)
+	runtime.GC()
+	v := s.Value()
+	assert.GreaterOrEqual(t, v, 0.0)
+	assert.Less(t, v, 0.1)
+}
+
+func TestSampled(t *testing.T) {
+	calls := 0
+	c := manual.New(time.Now())
+	f := sampled(c, func(time.Time) float64 {
+		calls++
+		return float64(calls)
+	})
+	assert.Equal(t, 1.0, f())
+	c.Advance(signalInterval - 1)
+	assert.Equal(t, 1.0, f())
+	c.Advance(1)
+	assert.Equal(t, 2.0, f())
+	assert.Equal(t, 2, calls)
+}
+
+func TestCPUSignal(t *testing.T) {
+	// a sampler never started reports no usage.
+	s := CPUSignal(cpu.NewSampler(time.Second, 0), 800)
+	assert.Equal(t, 0.0, s.Value())
+	assert.Equal(t, 800.0, s.Threshold())
+
+	// the signal without a sampler follows the cpu of the limiter.
+	limiter := NewLimiter(append(optsForTest, WithSignals(CPUSignal(nil, 800)))...)
+	limiter.cpu = func() int64 {
+		return 900
+	}
+	assert.Equal(t, 900.0, limiter.opts.Signals[0].Value())
+	assert.True(t, limiter.overloaded())
+}
+
+func TestCPUUsage(t *testing.T) {
+	usage := func() uint64 { return 400 }
+	assert.Equal(t, int64(400), cpuUsage(usage, 0)())
+	// the usage is scaled to the cpu quota.
+	assert.Equal(t, int64(800), cpuUsage(usage, float64(runtime.NumCPU())/2)())
+	assert.Equal(t, int64(1000), cpuUsage(func() uint64 { return 1200 }, 0)())
+}
+
+func TestUsesCPU(t *testing.T) {
+	heap := HeapSignal(0.9)
+	assert.True(t, usesCPU(nil))
+	assert.False(t, usesCPU([]Signal{heap}))
+	assert.True(t, usesCPU([]Signal{heap, CPUSignal(nil, 800)}))
+	// a signal with its own sampler does not need the one of the limiter.
+	assert.False(t, usesCPU([]Signal{heap, CPUSignal(cpu.NewSampler(time.Second, 0), 800)}))
+}
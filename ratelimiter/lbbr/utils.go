@@ -1,46 +1,82 @@
 package lbbr
 
 import (
-	"sync/atomic"
+	"math"
+	"runtime"
+	"sync"
 	"time"
 
+	"github.com/devexps/go-pkg/v2/clock"
 	"github.com/devexps/go-pkg/v2/cpu"
 )
 
+const (
+	// cpuDecay is the decay of the moving average of the default cpu usage
+	// every cpuInterval, cpu = cpuᵗ⁻¹ * decay + cpuᵗ * (1 - decay).
+	cpuDecay    = 0.95
+	cpuInterval = time.Millisecond * 500
+)
+
 var (
-	gCPU  int64
-	decay = 0.95
+	defaultUsage func() uint64
+	defaultErr   error
+	defaultOnce  sync.Once
 )
 
-func init() {
-	go cpuproc()
+// getDefaultUsage returns the usage of cpu.DefaultSampler, shared by the
+// limiters without a sampler of their own, and the error of starting the
+// sampler, the usage then stays zero.
+func getDefaultUsage() (func() uint64, error) {
+	defaultOnce.Do(func() {
+		var s *cpu.Sampler
+		s, defaultErr = cpu.DefaultSampler()
+		defaultUsage = s.Usage
+	})
+	return defaultUsage, defaultErr
 }
 
-// cpu = cpuᵗ⁻¹ * decay + cpuᵗ * (1 - decay)
-func cpuproc() {
-	ticker := time.NewTicker(time.Millisecond * 500) // same to cpu sample rate
-	defer func() {
-		ticker.Stop()
-		if err := recover(); err != nil {
-			go cpuproc()
+// movingAverage returns the moving average of the usage, it is updated on
+// read at most once per signalInterval of the clock with the decay of the
+// elapsed time. The zero usage of a missing sample is skipped.
+func movingAverage(c clock.Clock, usage func() uint64) func() uint64 {
+	var (
+		prev     float64
+		prevTime time.Time
+	)
+	avg := sampled(c, func(now time.Time) float64 {
+		cur := float64(usage())
+		if cur == 0 {
+			return prev
+		}
+		if prev != 0 {
+			decay := math.Pow(cpuDecay, float64(now.Sub(prevTime))/float64(cpuInterval))
+			cur = prev*decay + cur*(1-decay)
 		}
-	}()
-
-	for range ticker.C {
-		stat := &cpu.Stat{}
-		cpu.ReadStat(stat)
-		stat.Usage = min(stat.Usage, 1000)
-		prevCPU := atomic.LoadInt64(&gCPU)
-		curCPU := int64(float64(prevCPU)*decay + float64(stat.Usage)*(1.0-decay))
-		atomic.StoreInt64(&gCPU, curCPU)
+		prev, prevTime = cur, now
+		return cur
+	})
+	return func() uint64 {
+		return uint64(avg())
 	}
 }
 
-func min(l, r uint64) uint64 {
-	if l < r {
-		return l
+// cpuUsage returns the getter of the usage capped to 1000, scaled to the
+// number of cpus by a non zero quota.
+func cpuUsage(usage func() uint64, quota float64) cpuGetter {
+	capped := func() int64 {
+		u := usage()
+		if u > 1000 {
+			u = 1000
+		}
+		return int64(u)
+	}
+	if quota == 0 {
+		return capped
+	}
+	// if cpuQuota is set, Calculate the real CPU value based on the number of CPUs and Quota.
+	return func() int64 {
+		return int64(float64(capped()) * float64(runtime.NumCPU()) / quota)
 	}
-	return r
 }
 
 // Stat contains the metrics snapshot of L-BBR.
@@ -50,6 +86,12 @@ type Stat struct {
 	MaxInFlight int64
 	MinRt       int64
 	MaxPass     int64
+	// Allowed is the number of requests allowed since the limiter started.
+	Allowed int64
+	// Dropped is the number of requests dropped since the limiter started.
+	Dropped int64
+	// Queued is the number of requests waiting in AllowCtx.
+	Queued int64
 }
 
 // counterCache is used to cache maxPASS and minRt result.
@@ -0,0 +1,72 @@
+package slidingwindow
+
+import (
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock"
+)
+
+// Mode is the way the requests within the window are counted.
+type Mode int
+
+const (
+	// ModeCounter counts the requests in the buckets of a rolling counter,
+	// the memory is bounded by the bucket number and the window slides
+	// one bucket at a time.
+	ModeCounter Mode = iota
+	// ModeLog keeps the time of every allowed request, the window slides
+	// exactly but the memory grows with the allowed requests, up to the limit.
+	ModeLog
+)
+
+// Option function for sliding window limiter
+type Option func(*options)
+
+// options of sliding window limiter.
+type options struct {
+	// Mode defines the way the requests are counted
+	Mode Mode
+	// Limit defines the number of requests allowed within the window
+	Limit int64
+	// Window defines the duration of the sliding window
+	Window time.Duration
+	// Bucket defines the bucket number of the window in ModeCounter
+	Bucket int
+	// Clock is the time source of the limiter
+	Clock clock.Clock
+}
+
+// WithMode with the way the requests are counted, default is ModeCounter.
+func WithMode(m Mode) Option {
+	return func(o *options) {
+		o.Mode = m
+	}
+}
+
+// WithLimit with the number of requests allowed within the window.
+func WithLimit(n int64) Option {
+	return func(o *options) {
+		o.Limit = n
+	}
+}
+
+// WithWindow with the duration of the sliding window.
+func WithWindow(d time.Duration) Option {
+	return func(o *options) {
+		o.Window = d
+	}
+}
+
+// WithBucket set the bucket number in a window duration, it is only used by ModeCounter.
+func WithBucket(b int) Option {
+	return func(o *options) {
+		o.Bucket = b
+	}
+}
+
+// WithClock with the time source of the limiter, default is the wall clock.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.Clock = c
+	}
+}
@@ -0,0 +1,102 @@
+package slidingwindow
+
+import (
+	"sync"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock"
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+	"github.com/devexps/go-pkg/v2/window"
+)
+
+var _ ratelimiter.RateLimiter = (*Limiter)(nil)
+
+// Limiter allows at most Limit requests within any rolling window.
+type Limiter struct {
+	mu    sync.Mutex
+	opts  options
+	count func(now time.Time) bool
+}
+
+// New returns a sliding window limiter with options.
+func New(opts ...Option) *Limiter {
+	opt := options{
+		Mode:   ModeCounter,
+		Limit:  100,
+		Window: time.Minute,
+		Bucket: 60,
+		Clock:  clock.New(),
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	l := &Limiter{opts: opt}
+	switch opt.Mode {
+	case ModeLog:
+		l.count = newLog(opt.Limit, opt.Window)
+	default:
+		l.count = newCounter(opt)
+	}
+	return l
+}
+
+// Allow checks whether another request fits in the window, the returned
+// DoneFunc does nothing.
+func (l *Limiter) Allow() (ratelimiter.DoneFunc, error) {
+	l.mu.Lock()
+	ok := l.count(l.opts.Clock.Now())
+	l.mu.Unlock()
+	if !ok {
+		return nil, ratelimiter.ErrLimitExceed
+	}
+	return func(ratelimiter.DoneInfo) {}, nil
+}
+
+// newLog returns a counter keeping the time of the last limit allowed
+// requests in a ring, the oldest of them must be out of the window
+// before another request is allowed. The ring grows with the allowed
+// requests up to limit, so a large limit costs nothing until it is used.
+func newLog(limit int64, size time.Duration) func(time.Time) bool {
+	if limit <= 0 {
+		return func(time.Time) bool { return false }
+	}
+	var (
+		ring []int64
+		head int
+	)
+	return func(now time.Time) bool {
+		ts := now.UnixNano()
+		if int64(len(ring)) < limit {
+			// the ring is not full yet, the oldest request stays at head.
+			ring = append(ring, ts)
+			return true
+		}
+		if ring[head] > ts-int64(size) {
+			return false
+		}
+		ring[head] = ts
+		head = (head + 1) % len(ring)
+		return true
+	}
+}
+
+// newCounter returns a counter summing the requests in the buckets of
+// a rolling counter.
+func newCounter(opt options) func(time.Time) bool {
+	bucket := opt.Bucket
+	if bucket < 1 {
+		bucket = 1
+	}
+	stat := window.NewRollingCounter(window.RollingCounterOpts{
+		Size:           bucket,
+		BucketDuration: opt.Window / time.Duration(bucket),
+		Clock:          opt.Clock,
+	})
+	return func(time.Time) bool {
+		if int64(stat.Sum()) >= opt.Limit {
+			return false
+		}
+		stat.Add(1)
+		return true
+	}
+}
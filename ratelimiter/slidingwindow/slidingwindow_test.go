@@ -0,0 +1,71 @@
+package slidingwindow
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock/manual"
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+	"github.com/devexps/go-pkg/v2/ratelimiter/internal/ratelimitertest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLog(t *testing.T) {
+	c := manual.New(time.Unix(1000, 0))
+	l := New(WithMode(ModeLog), WithLimit(3), WithWindow(time.Second), WithClock(c))
+	assert.Equal(t, 2, ratelimitertest.AllowN(l, 2))
+	c.Advance(500 * time.Millisecond)
+	assert.Equal(t, 1, ratelimitertest.AllowN(l, 2))
+	_, err := l.Allow()
+	assert.Equal(t, ratelimiter.ErrLimitExceed, err)
+
+	// the first two requests leave the window exactly one second later.
+	c.Advance(499 * time.Millisecond)
+	assert.Equal(t, 0, ratelimitertest.AllowN(l, 1))
+	c.Advance(time.Millisecond)
+	assert.Equal(t, 2, ratelimitertest.AllowN(l, 3))
+	c.Advance(500 * time.Millisecond)
+	assert.Equal(t, 1, ratelimitertest.AllowN(l, 3))
+}
+
+func TestLogLargeLimit(t *testing.T) {
+	// the ring grows with the allowed requests, not with the limit.
+	l := New(WithMode(ModeLog), WithLimit(math.MaxInt64), WithClock(manual.New(time.Unix(1000, 0))))
+	assert.Equal(t, 1000, ratelimitertest.AllowN(l, 1000))
+}
+
+func TestCounter(t *testing.T) {
+	c := manual.New(time.Unix(1000, 0))
+	l := New(WithLimit(3), WithWindow(time.Second), WithBucket(10), WithClock(c))
+	assert.Equal(t, 2, ratelimitertest.AllowN(l, 2))
+	c.Advance(500 * time.Millisecond)
+	assert.Equal(t, 1, ratelimitertest.AllowN(l, 2))
+
+	// the first bucket leaves the window once the window slid past it.
+	c.Advance(400 * time.Millisecond)
+	assert.Equal(t, 0, ratelimitertest.AllowN(l, 1))
+	c.Advance(100 * time.Millisecond)
+	assert.Equal(t, 2, ratelimitertest.AllowN(l, 3))
+	c.Advance(time.Second)
+	assert.Equal(t, 3, ratelimitertest.AllowN(l, 4))
+}
+
+func TestZeroLimit(t *testing.T) {
+	for _, mode := range []Mode{ModeCounter, ModeLog} {
+		l := New(WithMode(mode), WithLimit(0), WithClock(manual.New(time.Unix(1000, 0))))
+		assert.Equal(t, 0, ratelimitertest.AllowN(l, 1))
+	}
+}
+
+func BenchmarkAllow(b *testing.B) {
+	for name, mode := range map[string]Mode{"counter": ModeCounter, "log": ModeLog} {
+		b.Run(name, func(b *testing.B) {
+			l := New(WithMode(mode), WithLimit(1000))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, _ = l.Allow()
+			}
+		})
+	}
+}
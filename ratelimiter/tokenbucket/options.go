@@ -0,0 +1,38 @@
+package tokenbucket
+
+import "github.com/devexps/go-pkg/v2/clock"
+
+// Option function for token bucket limiter
+type Option func(*options)
+
+// options of token bucket limiter.
+type options struct {
+	// Rate defines the number of tokens added per second
+	Rate float64
+	// Burst defines the size of the bucket
+	Burst int
+	// Clock is the time source of the limiter
+	Clock clock.Clock
+}
+
+// WithRate with the number of tokens added per second, with a zero rate
+// the tokens of the burst are practically never added back.
+func WithRate(r float64) Option {
+	return func(o *options) {
+		o.Rate = r
+	}
+}
+
+// WithBurst with the maximum number of tokens in the bucket.
+func WithBurst(b int) Option {
+	return func(o *options) {
+		o.Burst = b
+	}
+}
+
+// WithClock with the time source of the limiter, default is the wall clock.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.Clock = c
+	}
+}
@@ -0,0 +1,169 @@
+package tokenbucket
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock"
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+	"github.com/devexps/go-pkg/v2/ratelimiter/internal/gcra"
+)
+
+var _ ratelimiter.RateLimiter = (*Limiter)(nil)
+
+// ErrWaitTimeout is returned by Wait when the token cannot be taken before
+// the deadline of the context, it matches ratelimiter.ErrLimitExceed with
+// errors.Is.
+var ErrWaitTimeout = fmt.Errorf("tokenbucket: wait timeout: %w", ratelimiter.ErrLimitExceed)
+
+// Limiter is a token bucket rate limiter, it is implemented as the
+// equivalent generic cell rate algorithm so that the fast path is a single
+// compare-and-swap instead of a lock.
+type Limiter struct {
+	// tat is the theoretical arrival time, in unix nanoseconds, of the
+	// request after the last taken token, the bucket is full when tat is
+	// not after now.
+	tat int64
+	// interval is the duration between two tokens in nanoseconds.
+	interval int64
+	// tolerance is the duration of a full bucket in nanoseconds.
+	tolerance int64
+
+	clock clock.Clock
+}
+
+// New returns a token bucket limiter with options.
+func New(opts ...Option) *Limiter {
+	opt := options{
+		Rate:  100,
+		Burst: 100,
+		Clock: clock.New(),
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	interval, tolerance := gcra.Params(opt.Rate, opt.Burst)
+	return &Limiter{
+		interval:  interval,
+		tolerance: tolerance,
+		clock:     opt.Clock,
+	}
+}
+
+// Allow takes a token if one is available, the returned DoneFunc does nothing.
+func (l *Limiter) Allow() (ratelimiter.DoneFunc, error) {
+	if _, ok := l.reserve(0); !ok {
+		return nil, ratelimiter.ErrLimitExceed
+	}
+	return func(ratelimiter.DoneInfo) {}, nil
+}
+
+// Wait takes a token, blocking until one is available or the context is
+// done. It fails at once if the context is already done, or if the token is
+// not available before the deadline of the context. The delay of the token
+// is measured with the clock of the limiter, and waited for in wall time
+// like the deadline.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	maxWait := time.Duration(math.MaxInt64)
+	if deadline, ok := ctx.Deadline(); ok {
+		maxWait = time.Until(deadline)
+	}
+	delay, ok := l.reserve(maxWait)
+	if !ok {
+		return ErrWaitTimeout
+	}
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	}
+}
+
+// Reserve reserves a token, the caller must wait for the Delay of the
+// Reservation before going on, or Cancel it.
+func (l *Limiter) Reserve() *Reservation {
+	delay, ok := l.reserve(time.Duration(math.MaxInt64))
+	return &Reservation{ok: ok, delay: delay, limiter: l}
+}
+
+// reserve takes a token if it is available within maxWait, and returns
+// the duration to wait for it.
+func (l *Limiter) reserve(maxWait time.Duration) (time.Duration, bool) {
+	now := l.clock.Now().UnixNano()
+	for {
+		prev := atomic.LoadInt64(&l.tat)
+		tat := prev
+		if tat < now {
+			tat = now
+		}
+		next := gcra.Add(tat, l.interval)
+		delay := time.Duration(next - l.tolerance - now)
+		if delay > maxWait {
+			return delay, false
+		}
+		if atomic.CompareAndSwapInt64(&l.tat, prev, next) {
+			if delay < 0 {
+				delay = 0
+			}
+			return delay, true
+		}
+	}
+}
+
+// cancel gives a reserved token back, the tokens taken after the
+// reservation are not affected.
+func (l *Limiter) cancel() {
+	now := l.clock.Now().UnixNano()
+	for {
+		prev := atomic.LoadInt64(&l.tat)
+		if prev <= now {
+			return
+		}
+		next := prev - l.interval
+		if next < now {
+			next = now
+		}
+		if atomic.CompareAndSwapInt64(&l.tat, prev, next) {
+			return
+		}
+	}
+}
+
+// Reservation is a token reserved by Limiter.Reserve.
+type Reservation struct {
+	ok       bool
+	delay    time.Duration
+	limiter  *Limiter
+	canceled int32
+}
+
+// OK reports whether the token is reserved.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay returns the duration to wait before the reserved token can be used.
+func (r *Reservation) Delay() time.Duration {
+	return r.delay
+}
+
+// Cancel gives the reserved token back to the limiter.
+func (r *Reservation) Cancel() {
+	if !r.ok || !atomic.CompareAndSwapInt32(&r.canceled, 0, 1) {
+		return
+	}
+	r.limiter.cancel()
+}
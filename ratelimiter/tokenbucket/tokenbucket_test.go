@@ -0,0 +1,179 @@
+package tokenbucket
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock/manual"
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllow(t *testing.T) {
+	c := manual.New(time.Unix(1000, 0))
+	l := New(WithRate(10), WithBurst(3), WithClock(c))
+	for i := 0; i < 3; i++ {
+		done, err := l.Allow()
+		assert.Nil(t, err)
+		done(ratelimiter.DoneInfo{})
+	}
+	_, err := l.Allow()
+	assert.Equal(t, ratelimiter.ErrLimitExceed, err)
+
+	// a token is added every 100ms.
+	c.Advance(99 * time.Millisecond)
+	_, err = l.Allow()
+	assert.Equal(t, ratelimiter.ErrLimitExceed, err)
+	c.Advance(time.Millisecond)
+	_, err = l.Allow()
+	assert.Nil(t, err)
+
+	// the bucket never holds more than the burst.
+	c.Advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		_, err = l.Allow()
+		assert.Nil(t, err)
+	}
+	_, err = l.Allow()
+	assert.Equal(t, ratelimiter.ErrLimitExceed, err)
+}
+
+func TestZeroRate(t *testing.T) {
+	c := manual.New(time.Now())
+	l := New(WithRate(0), WithBurst(5), WithClock(c))
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if _, err := l.Allow(); err == nil {
+			allowed++
+		}
+	}
+	assert.Equal(t, 5, allowed)
+	c.Advance(24 * time.Hour)
+	_, err := l.Allow()
+	assert.Equal(t, ratelimiter.ErrLimitExceed, err)
+	assert.False(t, l.Reserve().Delay() < 0)
+}
+
+func TestAllowConcurrent(t *testing.T) {
+	l := New(WithRate(1), WithBurst(100), WithClock(manual.New(time.Unix(1000, 0))))
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := l.Allow(); err == nil {
+					mu.Lock()
+					allowed++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 100, allowed)
+}
+
+func TestReserve(t *testing.T) {
+	c := manual.New(time.Unix(1000, 0))
+	l := New(WithRate(10), WithBurst(1), WithClock(c))
+	r := l.Reserve()
+	assert.True(t, r.OK())
+	assert.Equal(t, time.Duration(0), r.Delay())
+
+	r1 := l.Reserve()
+	assert.True(t, r1.OK())
+	assert.Equal(t, 100*time.Millisecond, r1.Delay())
+	r2 := l.Reserve()
+	assert.Equal(t, 200*time.Millisecond, r2.Delay())
+
+	// canceling gives the token back, only once.
+	r2.Cancel()
+	r2.Cancel()
+	assert.Equal(t, 200*time.Millisecond, l.Reserve().Delay())
+
+	c.Advance(time.Hour)
+	r3 := l.Reserve()
+	assert.Equal(t, time.Duration(0), r3.Delay())
+	// a token of the past can not be given back.
+	c.Advance(time.Hour)
+	r3.Cancel()
+	_, err := l.Allow()
+	assert.Nil(t, err)
+	_, err = l.Allow()
+	assert.Equal(t, ratelimiter.ErrLimitExceed, err)
+}
+
+func TestWait(t *testing.T) {
+	t.Run("wait for a token", func(t *testing.T) {
+		l := New(WithRate(50), WithBurst(1))
+		assert.Nil(t, l.Wait(context.Background()))
+		start := time.Now()
+		assert.Nil(t, l.Wait(context.Background()))
+		assert.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+	})
+	t.Run("exceed deadline", func(t *testing.T) {
+		c := manual.New(time.Unix(1000, 0))
+		l := New(WithRate(1), WithBurst(1), WithClock(c))
+		assert.Nil(t, l.Wait(context.Background()))
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := l.Wait(ctx)
+		assert.Equal(t, ErrWaitTimeout, err)
+		assert.True(t, errors.Is(err, ratelimiter.ErrLimitExceed))
+
+		// the token 5ms away on the clock of the limiter is waited for
+		// within the deadline.
+		c.Advance(995 * time.Millisecond)
+		assert.Nil(t, l.Wait(ctx))
+	})
+	t.Run("context done", func(t *testing.T) {
+		l := New(WithRate(1), WithBurst(2), WithClock(manual.New(time.Unix(1000, 0))))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.Equal(t, context.Canceled, l.Wait(ctx))
+		ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+		assert.Equal(t, context.DeadlineExceeded, l.Wait(ctx))
+		// no token is taken.
+		assert.Equal(t, time.Duration(0), l.Reserve().Delay())
+		assert.Equal(t, time.Duration(0), l.Reserve().Delay())
+	})
+	t.Run("canceled", func(t *testing.T) {
+		l := New(WithRate(1), WithBurst(1), WithClock(manual.New(time.Unix(1000, 0))))
+		assert.Nil(t, l.Wait(context.Background()))
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+		}()
+		assert.Equal(t, context.Canceled, l.Wait(ctx))
+		// the canceled token is given back.
+		assert.Equal(t, time.Second, l.Reserve().Delay())
+	})
+}
+
+func BenchmarkAllow(b *testing.B) {
+	l := New(WithRate(1e9), WithBurst(1e6))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = l.Allow()
+	}
+}
+
+func BenchmarkAllowParallel(b *testing.B) {
+	l := New(WithRate(1e9), WithBurst(1e6))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = l.Allow()
+		}
+	})
+}
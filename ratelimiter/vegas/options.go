@@ -0,0 +1,59 @@
+package vegas
+
+import (
+	"github.com/devexps/go-pkg/v2/clock"
+	"github.com/devexps/go-pkg/v2/ratelimiter/internal/adaptive"
+)
+
+// Option function for vegas limiter
+type Option func(*options)
+
+// options of vegas limiter.
+type options struct {
+	adaptive.Options
+	// Probe defines the number of samples per unit of limit between two resets of the no-load RTT
+	Probe int64
+}
+
+// WithInitialLimit with the concurrency limit before any sample.
+func WithInitialLimit(n int64) Option {
+	return func(o *options) {
+		o.InitialLimit = n
+	}
+}
+
+// WithMinLimit with the lowest concurrency limit.
+func WithMinLimit(n int64) Option {
+	return func(o *options) {
+		o.MinLimit = n
+	}
+}
+
+// WithMaxLimit with the highest concurrency limit.
+func WithMaxLimit(n int64) Option {
+	return func(o *options) {
+		o.MaxLimit = n
+	}
+}
+
+// WithSmoothing with the weight of a new limit against the current one, in (0, 1].
+func WithSmoothing(s float64) Option {
+	return func(o *options) {
+		o.Smoothing = s
+	}
+}
+
+// WithProbe with the number of samples, per unit of the limit, after which
+// the no-load RTT is measured again, zero never measures it again.
+func WithProbe(n int64) Option {
+	return func(o *options) {
+		o.Probe = n
+	}
+}
+
+// WithClock with the time source of the limiter, default is the wall clock.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.Clock = c
+	}
+}
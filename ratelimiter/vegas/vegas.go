@@ -0,0 +1,116 @@
+package vegas
+
+import (
+	"math"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/ratelimiter"
+	"github.com/devexps/go-pkg/v2/ratelimiter/internal/adaptive"
+)
+
+var _ ratelimiter.RateLimiter = (*Limiter)(nil)
+
+// Limiter is an adaptive concurrency limiter in the manner of TCP Vegas,
+// it estimates the requests queued downstream from the RTT of a request and
+// the minimum RTT seen, the no-load RTT:
+//
+//	queue = limit * (1 - noLoadRTT / rtt)
+//
+// and grows the limit while the queue is short, shrinks it while the queue
+// is long. A failure shrinks the limit by a step of log10(limit).
+type Limiter struct {
+	limiter *adaptive.Limiter
+
+	// noLoadRTT is the minimum RTT since the last probe, guarded by the
+	// lock of the limiter.
+	noLoadRTT time.Duration
+	// probeIn is the number of samples before the next probe.
+	probeIn int64
+
+	opts options
+}
+
+// Stat contains the metrics snapshot of the vegas limiter.
+type Stat struct {
+	Limit     int64
+	InFlight  int64
+	NoLoadRTT time.Duration
+}
+
+// New returns a vegas limiter with options.
+func New(opts ...Option) *Limiter {
+	opt := options{
+		Options: adaptive.DefaultOptions(),
+		Probe:   30,
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	l := &Limiter{opts: opt}
+	l.limiter = adaptive.New(opt.Options, l.update)
+	l.resetProbe(float64(l.limiter.Stat(nil).Limit))
+	return l
+}
+
+// Allow implements ratelimiter.RateLimiter, the RTT reported to the
+// DoneFunc is compared to the no-load RTT.
+func (l *Limiter) Allow() (ratelimiter.DoneFunc, error) {
+	return l.limiter.Allow()
+}
+
+// Stat takes a snapshot of the vegas limiter.
+func (l *Limiter) Stat() Stat {
+	var noLoadRTT time.Duration
+	stat := l.limiter.Stat(func() {
+		noLoadRTT = l.noLoadRTT
+	})
+	return Stat{
+		Limit:     stat.Limit,
+		InFlight:  stat.InFlight,
+		NoLoadRTT: noLoadRTT,
+	}
+}
+
+// update estimates the queue from the RTT of the sample and the no-load
+// RTT, and steps the limit toward a queue between alpha and beta.
+func (l *Limiter) update(limit float64, s adaptive.Sample) float64 {
+	// the no-load RTT is measured again from time to time, in case the
+	// latency of the downstream has changed for good.
+	if l.opts.Probe > 0 {
+		if l.probeIn--; l.probeIn <= 0 {
+			l.resetProbe(limit)
+			l.noLoadRTT = 0
+		}
+	}
+	step := math.Max(1, math.Log10(limit))
+	if s.Failed {
+		return l.limiter.Smooth(limit, limit-step)
+	}
+	if s.RTT <= 0 {
+		return limit
+	}
+	if l.noLoadRTT == 0 || s.RTT < l.noLoadRTT {
+		l.noLoadRTT = s.RTT
+		return limit
+	}
+	// with few requests in flight the queue is short whatever the limit,
+	// growing it on such samples would overshoot.
+	if float64(s.InFlight)*2 < limit {
+		return limit
+	}
+	queue := math.Ceil(limit * (1 - float64(l.noLoadRTT)/float64(s.RTT)))
+	alpha, beta := 3*step, 6*step
+	switch {
+	case queue <= step:
+		return l.limiter.Smooth(limit, limit+beta)
+	case queue < alpha:
+		return l.limiter.Smooth(limit, limit+step)
+	case queue > beta:
+		return l.limiter.Smooth(limit, limit-step)
+	}
+	return limit
+}
+
+func (l *Limiter) resetProbe(limit float64) {
+	l.probeIn = l.opts.Probe * int64(limit)
+}
@@ -0,0 +1,57 @@
+package vegas
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock/manual"
+	"github.com/devexps/go-pkg/v2/ratelimiter/internal/ratelimitertest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoQueue(t *testing.T) {
+	c := manual.New(time.Unix(1000, 0))
+	l := New(WithClock(c), WithInitialLimit(10))
+	for i := 0; i < 5; i++ {
+		ratelimitertest.Round(l, c, 10*time.Millisecond, nil)
+	}
+	stat := l.Stat()
+	assert.Greater(t, stat.Limit, int64(50))
+	assert.Equal(t, 10*time.Millisecond, stat.NoLoadRTT)
+}
+
+func TestLongQueue(t *testing.T) {
+	c := manual.New(time.Unix(1000, 0))
+	l := New(WithClock(c), WithInitialLimit(100), WithProbe(0))
+	ratelimitertest.Round(l, c, 10*time.Millisecond, nil)
+	before := l.Stat().Limit
+	// half of the RTT is spent queued.
+	for i := 0; i < 5; i++ {
+		ratelimitertest.Round(l, c, 20*time.Millisecond, nil)
+	}
+	assert.Less(t, l.Stat().Limit, before)
+}
+
+func TestFailures(t *testing.T) {
+	c := manual.New(time.Unix(1000, 0))
+	l := New(WithClock(c), WithInitialLimit(100))
+	errTest := errors.New("unavailable")
+	// the failures of the requests in flight together take log10(limit)
+	// off the limit once.
+	assert.Equal(t, 100, ratelimitertest.Round(l, c, 10*time.Millisecond, errTest))
+	assert.Equal(t, int64(98), l.Stat().Limit)
+	ratelimitertest.Round(l, c, 10*time.Millisecond, errTest)
+	assert.Equal(t, int64(96), l.Stat().Limit)
+}
+
+func TestProbe(t *testing.T) {
+	c := manual.New(time.Unix(1000, 0))
+	l := New(WithClock(c), WithInitialLimit(2), WithMaxLimit(2), WithProbe(1))
+	ratelimitertest.Round(l, c, 10*time.Millisecond, nil)
+	assert.Equal(t, 10*time.Millisecond, l.Stat().NoLoadRTT)
+	ratelimitertest.Round(l, c, 50*time.Millisecond, nil)
+	// the no-load RTT is measured again after limit * probe samples,
+	// even if it is higher than the previous one.
+	assert.Equal(t, 50*time.Millisecond, l.Stat().NoLoadRTT)
+}
@@ -0,0 +1,56 @@
+package retry
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff returns the delay before a retry.
+type Backoff interface {
+	// Backoff returns the delay before the given retry, starting from 1.
+	Backoff(retries int) time.Duration
+}
+
+var _ Backoff = Exponential{}
+
+// Exponential is an exponential Backoff with jitter.
+type Exponential struct {
+	// BaseDelay is the delay before the first retry.
+	BaseDelay time.Duration
+	// MaxDelay is the upper bound of the delay, jitter included.
+	MaxDelay time.Duration
+	// Multiplier is the factor the delay is multiplied with after each retry.
+	Multiplier float64
+	// Jitter is the factor the delay is randomized with, e.g. 0.2 picks
+	// the delay in [0.8 * delay, 1.2 * delay).
+	Jitter float64
+}
+
+// DefaultExponential is the Exponential backoff used by default.
+var DefaultExponential = Exponential{
+	BaseDelay:  100 * time.Millisecond,
+	MaxDelay:   10 * time.Second,
+	Multiplier: 1.6,
+	Jitter:     0.2,
+}
+
+// Backoff returns the delay before the given retry.
+func (e Exponential) Backoff(retries int) time.Duration {
+	if retries < 1 {
+		retries = 1
+	}
+	// capped before the jitter too, as the power overflows to +Inf.
+	delay := math.Min(float64(e.BaseDelay)*math.Pow(e.Multiplier, float64(retries-1)), math.MaxInt64)
+	delay *= 1 + e.Jitter*(2*rand.Float64()-1)
+	if max := float64(e.MaxDelay); max > 0 && delay > max {
+		delay = max
+	}
+	if delay < 0 {
+		return 0
+	}
+	if delay >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(delay)
+}
@@ -0,0 +1,110 @@
+package retry
+
+import (
+	"sync"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/clock"
+	"github.com/devexps/go-pkg/v2/window"
+)
+
+// BudgetOption is Budget option function.
+type BudgetOption func(*budgetOptions)
+
+type budgetOptions struct {
+	ratio      float64
+	minRetries int64
+	bucket     int
+	window     time.Duration
+	clock      clock.Clock
+}
+
+// WithRatio with the ratio of retries to the recent successful requests.
+func WithRatio(r float64) BudgetOption {
+	return func(o *budgetOptions) {
+		o.ratio = r
+	}
+}
+
+// WithMinRetries with the number of retries allowed within the window
+// regardless of the ratio, so that low traffic can be retried too.
+func WithMinRetries(n int64) BudgetOption {
+	return func(o *budgetOptions) {
+		o.minRetries = n
+	}
+}
+
+// WithWindow with the duration size of the statistical window.
+func WithWindow(d time.Duration) BudgetOption {
+	return func(o *budgetOptions) {
+		o.window = d
+	}
+}
+
+// WithBucket set the bucket number in a window duration.
+func WithBucket(b int) BudgetOption {
+	return func(o *budgetOptions) {
+		o.bucket = b
+	}
+}
+
+// WithClock with the time source of the statistical window,
+// default is the wall clock.
+func WithClock(c clock.Clock) BudgetOption {
+	return func(o *budgetOptions) {
+		o.clock = c
+	}
+}
+
+// Budget caps the retries to a ratio of the successful requests within
+// a rolling window, like a token bucket refilled by the successes.
+type Budget struct {
+	mu       sync.Mutex
+	requests window.RollingCounter
+	retries  window.RollingCounter
+
+	ratio      float64
+	minRetries int64
+}
+
+// NewBudget returns a retry Budget with options.
+func NewBudget(opts ...BudgetOption) *Budget {
+	opt := budgetOptions{
+		ratio:      0.1,
+		minRetries: 10,
+		bucket:     10,
+		window:     10 * time.Second,
+		clock:      clock.New(),
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	counterOpts := window.RollingCounterOpts{
+		Size:           opt.bucket,
+		BucketDuration: time.Duration(int64(opt.window) / int64(opt.bucket)),
+		Clock:          opt.clock,
+	}
+	return &Budget{
+		requests:   window.NewRollingCounter(counterOpts),
+		retries:    window.NewRollingCounter(counterOpts),
+		ratio:      opt.ratio,
+		minRetries: opt.minRetries,
+	}
+}
+
+// Deposit records a successful request.
+func (b *Budget) Deposit() {
+	b.requests.Add(1)
+}
+
+// Withdraw spends a retry, it returns false when the budget is exhausted.
+func (b *Budget) Withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	allowed := b.ratio*float64(b.requests.Value()) + float64(b.minRetries)
+	if float64(b.retries.Value()) >= allowed {
+		return false
+	}
+	b.retries.Add(1)
+	return true
+}
@@ -0,0 +1,132 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/circuitbreaker"
+)
+
+// Option is retry option function.
+type Option func(*options)
+
+type options struct {
+	attempts   int
+	backoff    Backoff
+	budget     *Budget
+	breaker    circuitbreaker.CircuitBreaker
+	classifier circuitbreaker.Classifier
+	retryable  func(error) bool
+}
+
+// WithMaxAttempts with the maximum number of attempts including the first one.
+func WithMaxAttempts(n int) Option {
+	return func(o *options) {
+		o.attempts = n
+	}
+}
+
+// WithBackoff with the backoff between the attempts, default is DefaultExponential.
+func WithBackoff(b Backoff) Option {
+	return func(o *options) {
+		o.backoff = b
+	}
+}
+
+// WithBudget with the budget capping the retries, the budget may be shared.
+func WithBudget(b *Budget) Option {
+	return func(o *options) {
+		o.budget = b
+	}
+}
+
+// WithBreaker with the circuit breaker consulted before each attempt,
+// the retries stop as soon as the breaker rejects an attempt.
+func WithBreaker(cb circuitbreaker.CircuitBreaker) Option {
+	return func(o *options) {
+		o.breaker = cb
+	}
+}
+
+// WithClassifier with the classifier marking the breaker, see circuitbreaker.Do.
+func WithClassifier(c circuitbreaker.Classifier) Option {
+	return func(o *options) {
+		o.classifier = c
+	}
+}
+
+// WithRetryable with the predicate reporting whether an error is worth
+// a retry, by default every error is except the context errors.
+func WithRetryable(f func(error) bool) Option {
+	return func(o *options) {
+		o.retryable = f
+	}
+}
+
+// Do calls fn until it succeeds, the attempts are exhausted, the error is not
+// retryable, the budget is exhausted, the breaker rejects the attempt or the
+// context is done. It returns the error of the last attempt, or the error of
+// the context if it is done while waiting for the next attempt.
+func Do(ctx context.Context, fn func(context.Context) error, opts ...Option) error {
+	o := options{
+		attempts: 3,
+		backoff:  DefaultExponential,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	for attempt := 1; ; attempt++ {
+		err := o.call(ctx, fn)
+		if err == nil {
+			if o.budget != nil {
+				o.budget.Deposit()
+			}
+			return nil
+		}
+		if attempt >= o.attempts || !o.shouldRetry(ctx, err) {
+			return err
+		}
+		if o.budget != nil && !o.budget.Withdraw() {
+			return err
+		}
+		if err := sleep(ctx, o.backoff.Backoff(attempt)); err != nil {
+			return err
+		}
+	}
+}
+
+func (o *options) call(ctx context.Context, fn func(context.Context) error) error {
+	if o.breaker == nil {
+		return fn(ctx)
+	}
+	var opts []circuitbreaker.CallOption
+	if o.classifier != nil {
+		opts = append(opts, circuitbreaker.WithClassifier(o.classifier))
+	}
+	return circuitbreaker.Do(ctx, o.breaker, fn, opts...)
+}
+
+func (o *options) shouldRetry(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, circuitbreaker.ErrNotAllowed) {
+		return false
+	}
+	if o.retryable != nil {
+		return o.retryable(err)
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,122 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/devexps/go-pkg/v2/circuitbreaker"
+	"github.com/devexps/go-pkg/v2/circuitbreaker/threestate"
+	"github.com/devexps/go-pkg/v2/clock/manual"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	errTest   = errors.New("test")
+	noBackoff = WithBackoff(Exponential{})
+	ctx       = context.Background()
+)
+
+// failedCalls returns a function failing the first n calls.
+func failedCalls(n int, calls *int) func(context.Context) error {
+	return func(context.Context) error {
+		*calls++
+		if *calls <= n {
+			return errTest
+		}
+		return nil
+	}
+}
+
+func TestDo(t *testing.T) {
+	t.Run("succeed after retries", func(t *testing.T) {
+		var calls int
+		assert.Nil(t, Do(ctx, failedCalls(2, &calls), noBackoff))
+		assert.Equal(t, 3, calls)
+	})
+	t.Run("attempts exhausted", func(t *testing.T) {
+		var calls int
+		assert.Equal(t, errTest, Do(ctx, failedCalls(5, &calls), noBackoff, WithMaxAttempts(4)))
+		assert.Equal(t, 4, calls)
+	})
+	t.Run("not retryable", func(t *testing.T) {
+		var calls int
+		err := Do(ctx, failedCalls(5, &calls), noBackoff, WithRetryable(func(err error) bool {
+			return !errors.Is(err, errTest)
+		}))
+		assert.Equal(t, errTest, err)
+		assert.Equal(t, 1, calls)
+	})
+	t.Run("context done while waiting", func(t *testing.T) {
+		var calls int
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		err := Do(ctx, failedCalls(5, &calls), WithBackoff(Exponential{BaseDelay: time.Hour}))
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func TestDoWithBreaker(t *testing.T) {
+	cb := threestate.NewBreaker(threestate.WithConsecutiveFailures(2))
+	var calls int
+	err := Do(ctx, failedCalls(5, &calls), noBackoff, WithMaxAttempts(5), WithBreaker(cb))
+	assert.Equal(t, circuitbreaker.ErrNotAllowed, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestBudget(t *testing.T) {
+	c := manual.New(time.Now())
+	b := NewBudget(WithRatio(0.5), WithMinRetries(1), WithWindow(time.Second), WithBucket(10), WithClock(c))
+	assert.True(t, b.Withdraw())
+	assert.False(t, b.Withdraw())
+
+	for i := 0; i < 4; i++ {
+		b.Deposit()
+	}
+	assert.True(t, b.Withdraw())
+	assert.True(t, b.Withdraw())
+	assert.False(t, b.Withdraw())
+
+	c.Advance(time.Second)
+	assert.True(t, b.Withdraw())
+	assert.False(t, b.Withdraw())
+
+	t.Run("retries stop", func(t *testing.T) {
+		var calls int
+		assert.Equal(t, errTest, Do(ctx, failedCalls(5, &calls), noBackoff, WithMaxAttempts(5), WithBudget(b)))
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func TestExponential(t *testing.T) {
+	e := Exponential{
+		BaseDelay:  100 * time.Millisecond,
+		MaxDelay:   time.Second,
+		Multiplier: 2,
+	}
+	assert.Equal(t, 100*time.Millisecond, e.Backoff(1))
+	assert.Equal(t, 400*time.Millisecond, e.Backoff(3))
+	assert.Equal(t, time.Second, e.Backoff(10))
+
+	e.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		d := e.Backoff(2)
+		assert.GreaterOrEqual(t, d, 160*time.Millisecond)
+		assert.Less(t, d, 240*time.Millisecond)
+	}
+
+	// the jitter does not exceed MaxDelay.
+	e.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		assert.LessOrEqual(t, e.Backoff(10), time.Second)
+	}
+
+	// without MaxDelay the delay saturates instead of overflowing.
+	e.MaxDelay = 0
+	assert.Greater(t, e.Backoff(2000), time.Duration(0))
+	e.Jitter = 0
+	assert.Equal(t, time.Duration(math.MaxInt64), e.Backoff(2000))
+}
@@ -3,6 +3,8 @@ package window
 import (
 	"fmt"
 	"time"
+
+	"github.com/devexps/go-pkg/v2/clock"
 )
 
 // Metric is a sample interface.
@@ -41,10 +43,23 @@ type RollingCounter interface {
 	Reduce(func(Iterator) float64) float64
 }
 
+// Snapshotter is implemented by the RollingCounter returned by
+// NewRollingCounter, check for it with a type assertion.
+type Snapshotter interface {
+	// Snapshot returns a copy of the buckets within the window.
+	Snapshot() Snapshot
+	// Restore adds the buckets of the snapshot to the window.
+	Restore(Snapshot)
+}
+
+var _ Snapshotter = (*rollingCounter)(nil)
+
 // RollingCounterOpts contains the arguments for creating RollingCounter.
 type RollingCounterOpts struct {
 	Size           int
 	BucketDuration time.Duration
+	// Clock is the time source of the counter, default is the wall clock.
+	Clock clock.Clock
 }
 
 type rollingCounter struct {
@@ -54,7 +69,7 @@ type rollingCounter struct {
 // NewRollingCounter creates a new RollingCounter bases on RollingCounterOpts.
 func NewRollingCounter(opts RollingCounterOpts) RollingCounter {
 	window := NewWindow(Options{Size: opts.Size})
-	policy := NewRollingPolicy(window, RollingPolicyOpts{BucketDuration: opts.BucketDuration})
+	policy := NewRollingPolicy(window, RollingPolicyOpts{BucketDuration: opts.BucketDuration, Clock: opts.Clock})
 	return &rollingCounter{
 		policy: policy,
 	}
@@ -71,6 +86,14 @@ func (r *rollingCounter) Reduce(f func(Iterator) float64) float64 {
 	return r.policy.Reduce(f)
 }
 
+func (r *rollingCounter) Snapshot() Snapshot {
+	return r.policy.Snapshot()
+}
+
+func (r *rollingCounter) Restore(s Snapshot) {
+	r.policy.Restore(s)
+}
+
 func (r *rollingCounter) Avg() float64 {
 	return r.policy.Reduce(Avg)
 }
@@ -1,6 +1,7 @@
 package window
 
 import (
+	"github.com/devexps/go-pkg/v2/clock/manual"
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"time"
@@ -42,6 +43,87 @@ func TestRollingCounterAdd(t *testing.T) {
 	assert.Equal(t, [][]float64{{5}, {15}, {7}}, listBuckets())
 }
 
+func TestRollingCounterWithClock(t *testing.T) {
+	c := manual.New(time.Now())
+	r := NewRollingCounter(RollingCounterOpts{
+		Size:           3,
+		BucketDuration: time.Second,
+		Clock:          c,
+	})
+	r.Add(1)
+	c.Advance(time.Second)
+	r.Add(2)
+	c.Advance(time.Second)
+	r.Add(3)
+	assert.Equal(t, int64(6), r.Value())
+
+	c.Advance(time.Second)
+	assert.Equal(t, int64(5), r.Value())
+	c.Advance(2 * time.Second)
+	assert.Equal(t, int64(0), r.Value())
+}
+
+func TestRollingCounterSnapshot(t *testing.T) {
+	c := manual.New(time.Now())
+	r := NewRollingCounter(RollingCounterOpts{
+		Size:           3,
+		BucketDuration: 100 * time.Millisecond,
+		Clock:          c,
+	})
+	start := c.Now()
+	r.Add(1)
+	c.Advance(100 * time.Millisecond)
+	r.Add(2)
+	r.Add(3)
+	c.Advance(100 * time.Millisecond)
+	r.Add(4)
+	assert.Equal(t, Snapshot{
+		Time:           start.Add(200 * time.Millisecond),
+		BucketDuration: 100 * time.Millisecond,
+		Buckets: []BucketSnapshot{
+			{Points: []float64{1}, Count: 1},
+			{Points: []float64{5}, Count: 2},
+			{Points: []float64{4}, Count: 1},
+		},
+	}, r.(Snapshotter).Snapshot())
+
+	c.Advance(100 * time.Millisecond)
+	assert.Len(t, r.(Snapshotter).Snapshot().Buckets, 2)
+	c.Advance(300 * time.Millisecond)
+	assert.Len(t, r.(Snapshotter).Snapshot().Buckets, 0)
+}
+
+func TestRollingCounterRestore(t *testing.T) {
+	c := manual.New(time.Now())
+	r := NewRollingCounter(RollingCounterOpts{
+		Size:           3,
+		BucketDuration: 100 * time.Millisecond,
+		Clock:          c,
+	})
+	r.Add(1)
+	c.Advance(100 * time.Millisecond)
+	r.Add(2)
+	c.Advance(100 * time.Millisecond)
+	r.Add(3)
+	c.Advance(50 * time.Millisecond)
+
+	restored := NewRollingCounter(RollingCounterOpts{
+		Size:           4,
+		BucketDuration: 50 * time.Millisecond,
+		Clock:          c,
+	})
+	restored.Add(10)
+	restored.(Snapshotter).Restore(r.(Snapshotter).Snapshot())
+	assert.Equal(t, int64(15), restored.Value())
+	// the first bucket is out of the window
+	assert.Equal(t, float64(3), restored.Reduce(Count))
+
+	c.Advance(100 * time.Millisecond)
+	assert.Equal(t, int64(13), restored.Value())
+	c.Advance(100 * time.Millisecond)
+	assert.Equal(t, int64(0), restored.Value())
+}
+
 func TestRollingCounterReduce(t *testing.T) {
 	size := 3
 	bucketDuration := time.Second
@@ -3,6 +3,8 @@ package window
 import (
 	"sync"
 	"time"
+
+	"github.com/devexps/go-pkg/v2/clock"
 )
 
 // RollingPolicy is a policy for ring window based on time duration.
@@ -17,22 +19,45 @@ type RollingPolicy struct {
 
 	bucketDuration time.Duration
 	lastAppendTime time.Time
+	clock          clock.Clock
+}
+
+// Snapshot is a copy of the buckets within a rolling window,
+// ordered from the oldest to the newest bucket.
+type Snapshot struct {
+	// Time is the start time of the newest bucket.
+	Time           time.Time        `json:"time"`
+	BucketDuration time.Duration    `json:"bucket_duration"`
+	Buckets        []BucketSnapshot `json:"buckets"`
+}
+
+// BucketSnapshot is a copy of a bucket.
+type BucketSnapshot struct {
+	Points []float64 `json:"points"`
+	Count  int64     `json:"count"`
 }
 
 // RollingPolicyOpts contains the arguments for creating RollingPolicy.
 type RollingPolicyOpts struct {
 	BucketDuration time.Duration
+	// Clock is the time source of the policy, default is the wall clock.
+	Clock clock.Clock
 }
 
 // NewRollingPolicy creates a new RollingPolicy based on the given window and RollingPolicyOpts.
 func NewRollingPolicy(window *Window, opts RollingPolicyOpts) *RollingPolicy {
+	c := opts.Clock
+	if c == nil {
+		c = clock.New()
+	}
 	return &RollingPolicy{
 		window: window,
 		size:   window.Size(),
 		offset: 0,
 
 		bucketDuration: opts.BucketDuration,
-		lastAppendTime: time.Now(),
+		lastAppendTime: c.Now(),
+		clock:          c,
 	}
 }
 
@@ -40,7 +65,7 @@ func NewRollingPolicy(window *Window, opts RollingPolicyOpts) *RollingPolicy {
 // if it is one bucket duration earlier than the last recorded
 // time, it will return the size.
 func (r *RollingPolicy) timespan() int {
-	v := int(time.Since(r.lastAppendTime) / r.bucketDuration)
+	v := int(r.clock.Since(r.lastAppendTime) / r.bucketDuration)
 	if v > -1 { // maybe time backwards
 		return v
 	}
@@ -95,3 +120,53 @@ func (r *RollingPolicy) Reduce(f func(Iterator) float64) (val float64) {
 	}
 	return val
 }
+
+// Snapshot returns a copy of the buckets within the window.
+func (r *RollingPolicy) Snapshot() Snapshot {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s := Snapshot{
+		Time:           r.lastAppendTime,
+		BucketDuration: r.bucketDuration,
+	}
+	if count := r.size - r.timespan(); count > 0 {
+		offset := r.offset - count + 1
+		if offset < 0 {
+			offset = offset + r.size
+		}
+		iterator := r.window.Iterator(offset, count)
+		for iterator.Next() {
+			bucket := iterator.Bucket()
+			s.Buckets = append(s.Buckets, BucketSnapshot{
+				Points: append([]float64(nil), bucket.Points...),
+				Count:  bucket.Count,
+			})
+		}
+	}
+	return s
+}
+
+// Restore adds the buckets of the snapshot to the buckets of the window
+// covering the same time, the snapshot may come from a window of another
+// size and bucket duration. Buckets which are out of the window are dropped.
+func (r *RollingPolicy) Restore(s Snapshot) {
+	r.apply(func(offset int, _ float64) {
+		n := len(s.Buckets)
+		for i, bucket := range s.Buckets {
+			if len(bucket.Points) == 0 {
+				continue
+			}
+			start := s.Time.Add(-time.Duration(n-1-i) * s.BucketDuration)
+			// the number of buckets between the current one and the one covering start.
+			span := 0
+			if start.Before(r.lastAppendTime) {
+				span = int((r.lastAppendTime.Sub(start) + r.bucketDuration - 1) / r.bucketDuration)
+			}
+			if span >= r.size {
+				continue
+			}
+			r.window.buckets[(offset-span+r.size)%r.size].merge(bucket.Points, bucket.Count)
+		}
+	}, 0)
+}
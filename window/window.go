@@ -19,6 +19,18 @@ func (b *Bucket) Add(offset int, val float64) {
 	b.Count++
 }
 
+// merge adds the given points and count to the bucket.
+func (b *Bucket) merge(points []float64, count int64) {
+	for i, p := range points {
+		if i < len(b.Points) {
+			b.Points[i] += p
+			continue
+		}
+		b.Points = append(b.Points, p)
+	}
+	b.Count += count
+}
+
 // Reset empties the bucket.
 func (b *Bucket) Reset() {
 	b.Points = b.Points[:0]